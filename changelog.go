@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// changelogFileName is the name of the file in the root of the generated package that
+// records what changed each time it was regenerated.
+const changelogFileName = "CHANGELOG.md"
+
+// diffManifests returns a line describing each of the changes from the previous manifest
+// to the current one that matter to the users of the package, which leaves out things like
+// when and with which version of this tool it was generated.
+func diffManifests(prev, cur *manifest) []string {
+	var changes []string
+	if prev.Version != cur.Version {
+		changes = append(changes, fmt.Sprintf("The font's version changed from `%s` to `%s`.", or(prev.Version, "unknown"), or(cur.Version, "unknown")))
+	}
+	if prev.License != cur.License {
+		changes = append(changes, fmt.Sprintf("The license changed from %s to %s.", or(prev.License, "an unrecognized one"), or(cur.License, "an unrecognized one")))
+	}
+
+	prevVariants := make(map[string]manifestVariant, len(prev.Variants))
+	for _, v := range prev.Variants {
+		prevVariants[v.PkgName] = v
+	}
+	curVariants := make(map[string]bool, len(cur.Variants))
+	for _, v := range cur.Variants {
+		curVariants[v.PkgName] = true
+		old, ok := prevVariants[v.PkgName]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("Added the `%s` variant (%s).", v.PkgName, v.SourcePath))
+		case old.SHA256 != v.SHA256 && old.Version != v.Version:
+			changes = append(changes, fmt.Sprintf("Updated the `%s` variant from `%s` to `%s`.", v.PkgName, or(old.Version, "unknown"), or(v.Version, "unknown")))
+		case old.SHA256 != v.SHA256:
+			changes = append(changes, fmt.Sprintf("Updated the font file of the `%s` variant.", v.PkgName))
+		}
+	}
+	for _, v := range prev.Variants {
+		if !curVariants[v.PkgName] {
+			changes = append(changes, fmt.Sprintf("Removed the `%s` variant (%s).", v.PkgName, v.SourcePath))
+		}
+	}
+	return changes
+}
+
+// or returns s, or def if s is empty.
+func or(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// writeChangelog adds a section to the top of the package's changelog with the changes
+// since the previous manifest, if there are any.
+func writeChangelog(fnt *fontPkgInfo, prev, cur *manifest) error {
+	changes := diffManifests(prev, cur)
+	if len(changes) == 0 {
+		logInfo("nothing changed since the previous generation, so the changelog is left as is")
+		return nil
+	}
+
+	p := filepath.Join(fnt.DirName, changelogFileName)
+	if fnt.cfg.DryRun {
+		logDryRun("add %d changes to '%s'", len(changes), p)
+		return nil
+	}
+
+	var section strings.Builder
+	fmt.Fprintf(&section, "## %s", cur.Generated.Format("2006-01-02"))
+	if cur.Version != "" {
+		fmt.Fprintf(&section, " (%s)", cur.Version)
+	}
+	section.WriteString("\n\n")
+	for _, c := range changes {
+		section.WriteString("- " + c + "\n")
+	}
+	section.WriteString("\n")
+
+	// New sections go right after the title, so that the latest changes come first.
+	const title = "# Changelog\n\n"
+	b, err := os.ReadFile(p)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	b = bytes.TrimPrefix(b, []byte(title))
+	fnt.track(p)
+	return os.WriteFile(p, append([]byte(title+section.String()), b...), 0o644)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// configFileName is the name of the config file that's loaded from the working directory
+// by default, if there is one.
+const configFileName = "mkfontpkg.config.json"
+
+// config is the options for a single run of the tool, which are set from its command line
+// flags.
+type config struct {
+	BuildCheck     bool
+	BuildTags      bool
+	Commit         bool
+	CommitMessage  string
+	CopyExtra      string
+	DryRun         bool
+	DirPath        string
+	DirPrefix      string
+	Download       bool
+	EmbedFS        bool
+	Exclude        string
+	ExcludeLicense bool
+	Header         string
+	FailOnExist    bool
+	Flat           bool
+	Font           string
+	GioVersion     string
+	Force          bool
+	GitAuthor      string
+	GitEmail       string
+	GoVersion      string
+	Include        string
+	InitReadmeOnly bool
+	Instances      bool
+	JSON           bool
+	Jobs           int
+	KeepPartial    bool
+	KeepSrc        bool
+	List           bool
+	LicenseFile    string
+	LicenseRef     string
+	LicenseURL     string
+	LogFormat      string
+	LogLevel       string
+	LowercaseFiles bool
+	MaxWeight      int
+	MinWeight      int
+	Name           string
+	NameFrom       string
+	NoGit          bool
+	NoGitignore    bool
+	NoItalic       bool
+	NoMod          bool
+	NormalizeEOL   bool
+	ModPrefix      string
+	RequireLicense bool
+	Remote         string
+	OutDir         string
+	Overrides      string
+	PostHook       string
+	Prefer         string
+	Quiet          bool
+	Recurse        bool
+	SHA256         string
+	Stdout         bool
+	Subset         string
+	Verbose        bool
+	TemplatesDir   string
+	Timeout        time.Duration
+	VarName        string
+	Weights        string
+	Website        string
+	ZipDir         string
+	ZipList        bool
+	ZipPath        string
+	ZipPaths       stringList
+	KeepGoing      bool
+}
+
+// stringList is a flag that can be given more than once, which collects all of its values.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ", ") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// registerFlags defines the command line flags for each of the config's options in the
+// given flag set.
+func (cfg *config) registerFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&cfg.BuildCheck, "build-check", false, "run 'go build ./...' in the generated package after setting up its module, and fail if it doesn't compile")
+	fs.BoolVar(&cfg.BuildTags, "build-tags", false, "register each variant in a file of its own with a build constraint, so that apps can leave it out with '-tags nofont_<variant>' (or all of a format's with 'nofont_<pkg>_<format>')")
+	fs.BoolVar(&cfg.Commit, "commit", false, "commit the generated package after staging it in git, so that the repo has an initial commit rather than just staged files")
+	fs.StringVar(&cfg.CommitMessage, "commit-message", "Initial generation by mkfontpkg", "message of the commit made with -commit")
+	fs.StringVar(&cfg.CopyExtra, "copy-extra", "", "comma-separated glob patterns of other files within the zip to copy into the package as is (ex: '**/FONTLOG.txt,**/*.png')")
+	fs.BoolVar(&cfg.DryRun, "dry-run", false, "print the planned actions without writing anything or running any commands")
+	fs.StringVar(&cfg.DirPath, "dir", "", "path of the directory containing the fonts (instead of -zip)")
+	fs.StringVar(&cfg.DirPrefix, "dirprefix", "font-", "prefix of the output directory's name before the font's package name, which is also what .RepoName in -remote is made of")
+	fs.BoolVar(&cfg.Download, "download", false, "also run 'go mod download' for the generated package, so that its go.sum is complete for building without network access")
+	fs.BoolVar(&cfg.EmbedFS, "embed-fs", false, "embed all of the font files in the root package as an embed.FS under 'assets/', which they're read from by name, rather than making a sub package for each variant")
+	fs.StringVar(&cfg.Exclude, "exclude", "", "comma-separated glob patterns of files within the zip to skip, which win over -include (ex: 'variable/**')")
+	fs.BoolVar(&cfg.ExcludeLicense, "exclude-license", false, "don't copy the license files into the package, such as when they're tracked centrally (the license is still detected)")
+	fs.StringVar(&cfg.Header, "header", "", "path of a text file with the header comment to put at the top of each generated Go file (default an SPDX license identifier line, if the license is recognized)")
+	fs.BoolVar(&cfg.FailOnExist, "fail-on-exist", false, "abort if the output directory already contains files")
+	fs.BoolVar(&cfg.Flat, "flat", false, "embed all of the variants in the root package itself rather than making a sub package for each of them")
+	fs.StringVar(&cfg.Font, "font", "", "path of the single font file for -stdout (default stdin)")
+	fs.BoolVar(&cfg.Force, "force", false, "clear everything but .git from the output directory before generating")
+	fs.StringVar(&cfg.GioVersion, "gio-version", "", "version of gioui.org to require in the generated go.mod (ex: 'v0.9.0', default the latest one)")
+	fs.StringVar(&cfg.GitAuthor, "git-author", "", "name of the author and committer of the commit made with -commit (default the one in the git config)")
+	fs.StringVar(&cfg.GitEmail, "git-email", "", "email of the author and committer of the commit made with -commit (default the one in the git config)")
+	fs.StringVar(&cfg.GoVersion, "go-version", "", "go version to set in the generated go.mod (ex: '1.21', default the local toolchain's version)")
+	fs.StringVar(&cfg.Include, "include", "", "comma-separated glob patterns of the only files within the zip to process, where '**' matches any number of directories (ex: '**/*.ttf,*/OFL.txt')")
+	fs.BoolVar(&cfg.InitReadmeOnly, "init-readme-only", false, "only regenerate the README of the existing package in -out (or for -name) from its manifest, such as after changing the README template, without needing its source")
+	fs.BoolVar(&cfg.Instances, "instances", false, "make a variant package for each of the named instances of variable fonts, which share the variable font's data")
+	fs.BoolVar(&cfg.JSON, "json", false, "print the result of the run as a line of JSON on stdout instead of the summary, with the warnings in it rather than on stderr")
+	fs.IntVar(&cfg.Jobs, "jobs", runtime.NumCPU(), "number of font variants to process in parallel")
+	fs.BoolVar(&cfg.KeepPartial, "keep-partial", false, "keep whatever was generated if a run fails, rather than removing it")
+	fs.BoolVar(&cfg.KeepSrc, "keep-src", false, "also copy all of the source files into '_src/' in the package with their original paths, for reference")
+	fs.BoolVar(&cfg.List, "list", false, "just list the font and license files in the given zip file with the info read from them, without generating anything")
+	fs.StringVar(&cfg.LicenseFile, "license", "", "path to the license file")
+	fs.StringVar(&cfg.LicenseURL, "license-url", "", "URL of the license's canonical upstream page for the README to link to, in addition to the copied license files or -license-ref (ex: 'https://openfontlicense.org')")
+	fs.StringVar(&cfg.LicenseRef, "license-ref", "", "link to the license for the README to point to instead of the copied license files, like the central one with -exclude-license (ex: '../LICENSES/OFL-1.1.txt')")
+	fs.StringVar(&cfg.LogFormat, "log-format", "plain", "format of the log messages on stderr: 'plain', or slog's 'text' or 'json' for machines")
+	fs.StringVar(&cfg.LogLevel, "log-level", "", "lowest level of the messages to log: 'debug', 'info', 'warn' or 'error' (default 'warn', or 'info' with -v and 'error' with -quiet)")
+	fs.BoolVar(&cfg.LowercaseFiles, "lowercase-files", false, "lowercase the names of the font files written into the package (ex: 'vegur-bold.otf'), like their package names, rather than keeping the source's")
+	fs.IntVar(&cfg.MaxWeight, "max-weight", 0, "skip the variants with a weight above this one (ex: 700)")
+	fs.IntVar(&cfg.MinWeight, "min-weight", 0, "skip the variants with a weight below this one (ex: 300)")
+	fs.StringVar(&cfg.Name, "name", "", "package name of the font (default derived from the zip file or directory name), which is required when reading the zip file from stdin")
+	fs.StringVar(&cfg.NameFrom, "name-from", "zip", "where to derive the package name from when -name isn't given: the 'zip' file (or directory) name, or the font 'family' name of the first font file")
+	fs.BoolVar(&cfg.NoGit, "no-git", false, "don't run any git commands in the generated package")
+	fs.BoolVar(&cfg.NoGitignore, "no-gitignore", false, "don't write a .gitignore of Go build and test artifacts into the generated package")
+	fs.BoolVar(&cfg.NoItalic, "no-italic", false, "skip the italic (and oblique) variants, such as for apps that don't use them or synthesize them")
+	fs.BoolVar(&cfg.NoMod, "no-mod", false, "don't run 'go mod init' or 'go mod tidy' for the generated package")
+	fs.BoolVar(&cfg.NormalizeEOL, "normalize-eol", true, "convert the CRLF line endings of the copied license and extra text files to LF (give -normalize-eol=false to copy them as is)")
+	fs.StringVar(&cfg.ModPrefix, "modprefix", "gio.tools/fonts", "module path prefix that the font's package name is appended to (a trailing slash is tolerated)")
+	fs.BoolVar(&cfg.RequireLicense, "require-license", false, "abort if no license file is found")
+	fs.BoolVar(&cfg.Quiet, "quiet", false, "don't print anything but errors, like the summary of what was generated or warnings (same as -log-level error)")
+	fs.BoolVar(&cfg.Recurse, "recurse", false, "also read the fonts in the zip files within the source (ex: a zip file of a zip file for each family), as part of the same font")
+	fs.StringVar(&cfg.Remote, "remote", "", "template of the git origin remote URL to add to new repos, like 'git@github.com:gio-tools/{{ .RepoName }}.git'")
+	fs.StringVar(&cfg.Overrides, "overrides", "", "path of a JSON file with the weight, style and function name to use for some of the source files in place of the detected ones, keyed by their paths or file names (ex: '{\"Vegur-Bold.otf\": {\"weight\": 800, \"name\": \"Heavy\"}}')")
+	fs.StringVar(&cfg.PostHook, "post-hook", "", "shell command to run in the output directory once the package has been generated, with its name, module path, directory and version in the MKFONTPKG_PKG, MKFONTPKG_MODULE, MKFONTPKG_DIR and MKFONTPKG_VERSION environment variables (ex: 'git push -u origin HEAD')")
+	fs.StringVar(&cfg.OutDir, "out", "", "path of the output directory (default -dirprefix + the font's package name)")
+	fs.StringVar(&cfg.Prefer, "prefer", "", "only keep the font files in this format ('otf' or 'ttf') when there are the same faces in other formats too, going by their file names")
+	fs.StringVar(&cfg.SHA256, "sha256", "", "hex SHA-256 hash that the -zip file must have, or else nothing is generated (default the one in a '<zip>.sha256' file next to it, if there is one)")
+	fs.BoolVar(&cfg.Stdout, "stdout", false, "just print the data.go of a variant package for the single font from -font or stdin, without generating anything")
+	fs.StringVar(&cfg.Subset, "subset", "", "subset the fonts to only the characters of a named set ('latin' or 'latin-ext'), or in a file of hex codepoints and ranges (ex: 'U+0020-007E'), which needs fontTools' pyftsubset command")
+	fs.BoolVar(&cfg.Verbose, "v", false, "print info on each step as it happens (same as -log-level info)")
+	fs.DurationVar(&cfg.Timeout, "timeout", 5*time.Minute, "how long each of the go, git and other commands may take before it's killed (ex: '30s', or 0 for no limit)")
+	fs.StringVar(&cfg.TemplatesDir, "templates", "", "path of a directory with templates to use in place of the built-in ones with the same file names (ex: 'root_pkg.go.tmpl')")
+	fs.StringVar(&cfg.VarName, "varname", "", "name of the exported font data variable in each variant package (default the all-caps font file extension, like \"TTF\")")
+	fs.StringVar(&cfg.Weights, "weights", "", "comma-separated weights of the only variants to keep, going by their OS/2 weight classes (ex: '400,500,700')")
+	fs.StringVar(&cfg.Website, "website", "", "path of the gio-tools website's content directory to add the font's vanity module path entry to (ex: 'website/content')")
+	fs.StringVar(&cfg.ZipDir, "zipdir", "", "only process the files within this directory of the zip (default all of them)")
+	fs.BoolVar(&cfg.ZipList, "zipls", false, "just list the font files in the given zip file")
+	fs.Var(&cfg.ZipPaths, "zip", "path of the zip (or tar, or gzipped tar) file containing the fonts, or '-' to read it from stdin; it can be given more than once, or be a directory of archives, to make a package from each of them in turn")
+	fs.BoolVar(&cfg.KeepGoing, "keep-going", false, "with several archives, keep on with the rest of them if one fails, and report which ones did at the end")
+}
+
+// loadConfigFile sets the flags in the given flag set from the JSON object in the config
+// file at the given path, whose keys are the flag names (ex: {"modprefix":
+// "example.com/fonts", "no-git": true}). Flags that were already set on the command line
+// are left as is, so that they override the file. The file is optional unless required
+// is set.
+func loadConfigFile(fs *flag.FlagSet, path string, required bool) error {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !required {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var values map[string]any
+	if err := json.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("parsing config file '%s': %w", path, err)
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	for name, v := range values {
+		if fs.Lookup(name) == nil || name == "config" || name == "version" {
+			return fmt.Errorf("unknown option '%s' in config file '%s'", name, path)
+		}
+		if explicit[name] {
+			continue
+		}
+		switch v.(type) {
+		case string, bool, float64:
+		default:
+			return fmt.Errorf("option '%s' in config file '%s' must be a string, number or boolean", name, path)
+		}
+		if err := fs.Set(name, fmt.Sprint(v)); err != nil {
+			return fmt.Errorf("option '%s' in config file '%s': %w", name, path, err)
+		}
+	}
+	return nil
+}
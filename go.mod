@@ -1,3 +1,10 @@
 module gio.tools/mkfontpkg
 
 go 1.21.0
+
+require (
+	github.com/andybalholm/brotli v1.1.1
+	golang.org/x/image v0.24.0
+)
+
+require golang.org/x/text v0.22.0 // indirect
@@ -0,0 +1,38 @@
+package main
+
+import "strings"
+
+// knownLicenses are the licenses that detectLicense can recognize. Each is identified by
+// all of its signature phrases appearing near the start of the license text.
+var knownLicenses = []struct {
+	id         string // The SPDX license ID
+	name       string
+	signatures []string
+}{
+	{"OFL-1.1", "SIL Open Font License 1.1", []string{"sil open font license", "version 1.1"}},
+	{"UFL-1.0", "Ubuntu Font Licence 1.0", []string{"ubuntu font licence", "version 1.0"}},
+	{"Apache-2.0", "Apache License 2.0", []string{"apache license", "version 2.0"}},
+	{"MIT", "MIT License", []string{"permission is hereby granted, free of charge"}},
+}
+
+// detectLicense returns the SPDX ID of the license in the given license file text, or
+// an empty string if it isn't one of the knownLicenses.
+func detectLicense(text []byte) string {
+	// The identifying phrases are always in the first few paragraphs, and comparing them
+	// is simpler with the case and line wrapping normalized away.
+	if len(text) > 1024 {
+		text = text[:1024]
+	}
+	s := strings.ToLower(strings.Join(strings.Fields(string(text)), " "))
+
+	for _, l := range knownLicenses {
+		matched := true
+		for _, sig := range l.signatures {
+			matched = matched && strings.Contains(s, sig)
+		}
+		if matched {
+			return l.id
+		}
+	}
+	return ""
+}
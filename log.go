@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// logger is what logInfo, warnf and fatalf log to. It's set up from the config's logging
+// options at the start of a run, since logging is the same for the whole process, and
+// only logs warnings and errors until then.
+var logger = slog.New(newPlainHandler(os.Stderr, slog.LevelWarn))
+
+// newLogger returns a logger that writes to w in the given format ("plain", "text" or
+// "json") and logs the messages of the given level ("debug", "info", "warn" or "error")
+// and above, or of the default level if it's empty.
+func newLogger(w io.Writer, format, level string, defaultLevel slog.Level) (*slog.Logger, error) {
+	lvl := defaultLevel
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid log level '%s'", level)
+		}
+	}
+
+	switch format {
+	case "plain":
+		return slog.New(newPlainHandler(w, lvl)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: lvl})), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: lvl})), nil
+	default:
+		return nil, fmt.Errorf("invalid log format '%s' (must be 'plain', 'text' or 'json')", format)
+	}
+}
+
+// plainHandler is the slog handler for people rather than machines, which writes each
+// message on its own line without a timestamp, prefixed with its level unless it's just
+// info (ex: "warning: no license file was found").
+type plainHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Level
+	attrs string
+}
+
+func newPlainHandler(w io.Writer, level slog.Level) *plainHandler {
+	return &plainHandler{mu: new(sync.Mutex), w: w, level: level}
+}
+
+func (h *plainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *plainHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("warning: ")
+	case r.Level < slog.LevelInfo:
+		b.WriteString("debug: ")
+	}
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		b.WriteString(" " + a.String())
+		return true
+	})
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *plainHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	for _, a := range attrs {
+		h2.attrs += " " + a.String()
+	}
+	return &h2
+}
+
+// WithGroup isn't supported, since nothing in this tool logs groups.
+func (h *plainHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// warningCollector is the slog handler for -json, which keeps the warnings so that they
+// can be reported in the run's result instead, and passes the records on to another
+// handler for whichever of them it logs.
+type warningCollector struct {
+	mu       *sync.Mutex
+	next     slog.Handler
+	warnings *[]string
+}
+
+func newWarningCollector(next slog.Handler) *warningCollector {
+	return &warningCollector{mu: new(sync.Mutex), next: next, warnings: new([]string)}
+}
+
+// Warnings returns the messages of all of the warnings that were logged so far.
+func (h *warningCollector) Warnings() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string{}, *h.warnings...)
+}
+
+func (h *warningCollector) Enabled(ctx context.Context, level slog.Level) bool {
+	return level == slog.LevelWarn || h.next.Enabled(ctx, level)
+}
+
+func (h *warningCollector) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level == slog.LevelWarn {
+		h.mu.Lock()
+		*h.warnings = append(*h.warnings, r.Message)
+		h.mu.Unlock()
+	}
+	if h.next.Enabled(ctx, r.Level) {
+		return h.next.Handle(ctx, r)
+	}
+	return nil
+}
+
+func (h *warningCollector) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.next = h.next.WithAttrs(attrs)
+	return &h2
+}
+
+func (h *warningCollector) WithGroup(name string) slog.Handler {
+	h2 := *h
+	h2.next = h.next.WithGroup(name)
+	return &h2
+}
@@ -1,35 +1,63 @@
 package main
 
 import (
-	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
 	_ "embed"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"go/format"
+	"go/token"
 	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/tabwriter"
 	"text/template"
-)
+	"time"
+	"unicode"
+	"unicode/utf8"
 
-var (
-	licenseFile = flag.String("license", "", "path to the license file")
-	verbose     = flag.Bool("v", false, "print info on each step as it happens")
-	zipDir      = flag.String("zipdir", "", "only process files that match this path prefix within the zip")
-	zipList     = flag.Bool("zipls", false, "just list the font files in the given zip file")
-	zipPath     = flag.String("zip", "", "path of the zip file containing the fonts")
+	"golang.org/x/image/font/sfnt"
 )
 
+// out is where the summary of what's generated and the other output besides the logs
+// goes, which is discarded with -quiet. The listings of -list and -zipls aren't, though,
+// since they're the whole point of those.
+var out io.Writer = os.Stdout
+
 func logInfo(format string, args ...any) {
-	if *verbose {
-		fmt.Printf(format, args...)
-	}
+	logger.Info(fmt.Sprintf(format, args...))
+}
+
+// logDryRun prints an action that would have been taken if -dry-run wasn't given. These
+// are printed regardless of -v.
+func logDryRun(format string, args ...any) {
+	fmt.Fprintf(out, "dry-run: would "+format+"\n", args...)
+}
+
+func warnf(format string, args ...any) {
+	logger.Warn(fmt.Sprintf(format, args...))
+}
+
+func logError(format string, args ...any) {
+	logger.Error(fmt.Sprintf(format, args...))
 }
 
 func fatalf(format string, args ...any) {
-	fmt.Fprintf(os.Stderr, "error: "+format+"\n", args...)
+	logError(format, args...)
 	os.Exit(2)
 }
 
@@ -42,6 +70,49 @@ func baseNameStem(s string) string {
 	return s
 }
 
+// sanitizePkgName returns the given name as a valid Go package name, by lowercasing it
+// and removing everything but ASCII letters and digits (ex: "Vegur Bold (1)" would return
+// "vegurbold1"). If that leaves it empty, starting with a digit or as a Go keyword, it's
+// prefixed with "font".
+func sanitizePkgName(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			sb.WriteRune(r)
+		}
+	}
+	name := sb.String()
+	if name == "" || ('0' <= name[0] && name[0] <= '9') || token.IsKeyword(name) {
+		name = "font" + name
+	}
+	return name
+}
+
+// sanitizeFileName returns the given font file name with each run of characters other
+// than ASCII letters, digits, "-", "_" and "." replaced by a "-", and without any left at
+// the ends of its stem (ex: "My Font[wght].ttf" would return "My-Font-wght.ttf"). A
+// //go:embed directive takes its file name as a glob pattern, so spaces, brackets and the
+// like would keep it from matching the file, and the go command refuses to embed many of
+// the others anyway. The stem falls back to the package name if nothing is left of it.
+func sanitizeFileName(fname, pkgName string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range baseNameStem(fname) {
+		if ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') || r == '-' || r == '_' || r == '.' {
+			sb.WriteRune(r)
+			dash = false
+		} else if !dash {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+	stem := strings.Trim(sb.String(), "-")
+	if stem == "" {
+		stem = pkgName
+	}
+	return stem + path.Ext(fname)
+}
+
 // copyToDisk copies the given Reader to the file at the given disk path, creating that
 // file if it doesn't exist or truncating it if it does.
 func copyToDisk(in io.Reader, diskPath string) error {
@@ -55,261 +126,2474 @@ func copyToDisk(in io.Reader, diskPath string) error {
 	return err
 }
 
+// writeGoFile executes the given template with the given data and writes its output to
+// the file at the given disk path, formatted the same as gofmt would. If the output
+// can't be formatted, the returned error includes it as is.
+func writeGoFile(diskPath string, tmpl *template.Template, data any) error {
+	src, err := executeGoTemplate(tmpl, data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(diskPath, src, 0o644)
+}
+
+// executeGoTemplate returns the gofmt'ed Go source that the given template generates
+// from the given data.
+func executeGoTemplate(tmpl *template.Template, data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting output of template '%s': %w\n%s", tmpl.Name(), err, buf.Bytes())
+	}
+	return src, nil
+}
+
 var (
 	// This is the template for each font variant's single Go source file which embeds and
 	// exports the corresponding OTF (or TTF) file content as a byte slice.
 	//
 	//go:embed variant_pkg.go.tmpl
 	variantPkgCodeTmplStr string
-	variantPkgCodeTmpl    = template.Must(template.New("variantPkgCode").Parse(variantPkgCodeTmplStr))
+	variantPkgCodeTmpl    *template.Template
 
 	// This is the template for a font's root package which parses and registers all of the
 	// exported OTF (or TTF) variants from its sub packages in a collection of Gio font faces.
 	//
 	//go:embed root_pkg.go.tmpl
 	rootPkgCodeTmplStr string
-	rootPkgCodeTmpl    = template.Must(template.New("rootPkgCode").Parse(rootPkgCodeTmplStr))
+	rootPkgCodeTmpl    *template.Template
+
+	// This is the template for a font's root package with -flat, which embeds all of the
+	// OTF (or TTF) variants itself rather than having a sub package for each of them.
+	//
+	//go:embed flat_pkg.go.tmpl
+	flatPkgCodeTmplStr string
+	flatPkgCodeTmpl    *template.Template
+
+	// This is the template for a font's root package with -embed-fs, which embeds all of
+	// the font files in its assets directory as an embed.FS that they're read from by name.
+	//
+	//go:embed embed_fs_pkg.go.tmpl
+	embedFSPkgCodeTmplStr string
+	embedFSPkgCodeTmpl    *template.Template
+
+	// This is the template for the file in a font's root package that registers one of its
+	// variants with -build-tags, which has the build constraint that leaves it out.
+	//
+	//go:embed variant_face.go.tmpl
+	variantFaceTmplStr string
+	variantFaceTmpl    *template.Template
+
+	// This is the template for the doc.go file of a font's root package, which has its
+	// package comment describing the font.
+	//
+	//go:embed doc.go.tmpl
+	docTmplStr string
+	docTmpl    *template.Template
+
+	// This is the template for a test in a font's root package which makes sure that all
+	// of its variants' embedded font data can be parsed.
+	//
+	//go:embed faces_test.go.tmpl
+	facesTestTmplStr string
+	facesTestTmpl    *template.Template
+
+	// This is the template for an example in a font's root package of using its collection
+	// with a Gio text shaper, which shows up in its docs.
+	//
+	//go:embed example_test.go.tmpl
+	exampleTestTmplStr string
+	exampleTestTmpl    *template.Template
 
 	// This is the template for a font's README file that goes in the root of the
 	// generated directory.
 	//
 	//go:embed readme.md.tmpl
 	readmeTmplStr string
-	readmeTmpl    = template.Must(template.New("readme").Parse(readmeTmplStr))
+	readmeTmpl    *template.Template
+
+	// This is the template for the .gitignore file of a font's generated directory, for
+	// the artifacts of building and testing it.
+	//
+	//go:embed gitignore.tmpl
+	gitignoreTmplStr string
+	gitignoreTmpl    *template.Template
 )
 
+// loadTemplates parses all of the templates, using the files in the given directory (if
+// it isn't empty) in place of the embedded templates with the same names.
+func loadTemplates(dir string) error {
+	for _, t := range []struct {
+		tmpl     **template.Template
+		fileName string
+		text     string
+	}{
+		{&variantPkgCodeTmpl, "variant_pkg.go.tmpl", variantPkgCodeTmplStr},
+		{&rootPkgCodeTmpl, "root_pkg.go.tmpl", rootPkgCodeTmplStr},
+		{&flatPkgCodeTmpl, "flat_pkg.go.tmpl", flatPkgCodeTmplStr},
+		{&embedFSPkgCodeTmpl, "embed_fs_pkg.go.tmpl", embedFSPkgCodeTmplStr},
+		{&variantFaceTmpl, "variant_face.go.tmpl", variantFaceTmplStr},
+		{&docTmpl, "doc.go.tmpl", docTmplStr},
+		{&facesTestTmpl, "faces_test.go.tmpl", facesTestTmplStr},
+		{&exampleTestTmpl, "example_test.go.tmpl", exampleTestTmplStr},
+		{&readmeTmpl, "readme.md.tmpl", readmeTmplStr},
+		{&gitignoreTmpl, "gitignore.tmpl", gitignoreTmplStr},
+	} {
+		text := t.text
+		if dir != "" {
+			b, err := os.ReadFile(filepath.Join(dir, t.fileName))
+			if err == nil {
+				logInfo("using template '%s' from '%s'", t.fileName, dir)
+				text = string(b)
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		var err error
+		if *t.tmpl, err = template.New(t.fileName).Parse(text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type fontPkgInfo struct {
 	PkgName     string
 	DirName     string
 	ModPath     string
 	Variants    []variantPkgInfo
-	LicenseFile string
+	LicenseFile string // The preferred license file, if there were several
+	License     string // The SPDX ID of the license, if it was recognized (ex: "OFL-1.1")
+
+	// LicenseFiles are all of the license files that were copied into the package, which
+	// is none with -exclude-license, and LicenseRef is where the README points to for the
+	// license instead of them, if it's given. LicenseURL is the canonical upstream page of
+	// the license, which the README links to in addition to either of them.
+	LicenseFiles []string
+	LicenseRef   string
+	LicenseURL   string
+
+	ExtraFiles []string // The other files that were copied into the package with -copy-extra
+	Flat       bool     // Whether the variants are all embedded in the root package, with -flat
+	EmbedFS    bool     // Whether the font files are embedded in the root package as an embed.FS, with -embed-fs
+	BuildTags  bool     // Whether each variant is registered by a file of its own with a build constraint, with -build-tags
+	SrcDir     string   // The directory that all of the source files are copied into with -keep-src ("_src"), if any
+
+	Header      string // The comment at the top of each generated Go file, after the generated code marker
+	RemoteURL   string // The URL of the git origin remote, if it should be added
+	ToolVersion string // The version of this tool that generated the package
+	Version     string // The font's version, which is the most common one of its variants (ex: "Version 2.010")
+	Subset      string // The -subset character set or file name that the fonts were subset to, if any
+
+	cfg         *config
+	licenseRank int    // The licenseRank of LicenseFile
+	weights     []int  // The only weights to keep, from -weights
+	ranges      string // The Unicode ranges to subset the fonts to, from -subset
+
+	// overrides are the -overrides file's entries, keyed by source path or file name.
+	overrides map[string]variantOverride
+
+	// generated is when the package is generated, which is fixed by SOURCE_DATE_EPOCH
+	// along with the modification times of its files if fixedTime is set.
+	generated time.Time
+	fixedTime bool
+
+	// created are the absolute paths of the files and directories that were created
+	// during the run, in order.
+	createdMu sync.Mutex
+	created   []string
+
+	// seen maps the hex SHA-256 hashes of the font data of the variants to the path of
+	// the source file they came from, and pkgNames maps the variants' package names to the
+	// same.
+	seen     map[string]string
+	pkgNames map[string]string
 }
 
 type variantPkgInfo struct {
 	FontFileName string // The source file (ex: "Vegur-Bold.otf")
 	PkgName      string // Derived from the source file name (ex: "vegurbold")
-	DataVarName  string // The all-caps file extension of the source file (ex: "OTF" or "TTF")
+	FuncName     string // The exported function in the root package that returns its face (ex: "BoldItalic")
+	DataVarName  string // The -varname flag, or the all-caps file extension of the source file (ex: "OTF" or "TTF")
+	Weight       int    // The OS/2 weight class of the font (ex: 700)
+	Italic       bool   // Whether the font is italic (or oblique)
+	Monospace    bool   // Whether the font is monospaced, from its post or OS/2 table
+
+	PostScriptName string // From the font's name table, if it has one (ex: "Vegur-Bold")
+	Family         string // Likewise (ex: "Vegur")
+	Version        string // Likewise (ex: "Version 2.010")
+
+	SourcePath string   // The path of the file it came from within the source (ex: "otf/Vegur-Bold.otf")
+	SHA256     string   // The hex SHA-256 hash of the font file written into the package
+	FileSize   int      // The size in bytes of the font file, which is zero for a named instance
+	Blocks     []string // The names of the Unicode blocks that the font covers (ex: "Basic Latin")
+
+	// For a named instance of a variable font, Instance is its subfamily name (ex:
+	// "Condensed Black") and Axes are its coordinates. It doesn't have a font file of its
+	// own, but shares the data of the variable font's variant package, which is then
+	// marked with HasInstances and isn't registered as a face itself.
+	Instance     string
+	Axes         []axisValue
+	DataPkgName  string
+	DataPkgPath  string
+	HasInstances bool
 }
 
-func createVariantPkg(fnt *fontPkgInfo, f *zip.File) error {
-	fname := f.FileInfo().Name()
-	variantPkgName := baseNameStem(fname)
-	variantPkgName = strings.ToLower(strings.Replace(variantPkgName, "-", "", -1))
+// FlatDataVarName returns the name of the unexported variable in the root package that has
+// the variant's font data with -flat, which is the variable font's for a named instance
+// (ex: "vegurboldOTF").
+func (v variantPkgInfo) FlatDataVarName() string {
+	if v.DataPkgName != "" {
+		return v.DataPkgName + v.DataVarName
+	}
+	return v.PkgName + v.DataVarName
+}
 
-	variantDir := fnt.DirName + "/" + variantPkgName
-	if err := os.Mkdir(variantDir, 0o755); err != nil {
-		if os.IsExist(err) {
-			logInfo("directory '%s' already exists\n", variantDir)
-		} else {
-			return err
+// GioWeight returns the name of the Gio font.Weight constant closest to the variant's
+// weight (ex: "Bold").
+func (v variantPkgInfo) GioWeight() string {
+	return gioWeight(v.Weight)
+}
+
+// styleName returns the variant's name for its face function in the root package, based
+// on its style (ex: "BoldItalic"), or on its name if it's a named instance.
+func (v variantPkgInfo) styleName() string {
+	if v.Instance != "" {
+		return exportName(v.Instance)
+	}
+	switch name := v.GioWeight() + v.Style(); name {
+	case "NormalRegular":
+		return "Regular"
+	case "NormalItalic":
+		return "Italic"
+	default:
+		return strings.TrimSuffix(name, "Regular")
+	}
+}
+
+// assignFuncNames sets the FuncName of each of the given variants to its style name,
+// unless that's shared by other variants (like with both a sans and a mono variant), in
+// which case all of those are named after their package names instead.
+func assignFuncNames(variants []variantPkgInfo) {
+	// The root package already has the Collection and Face functions, and the variants
+	// with names from -overrides keep them.
+	used := map[string]int{"Collection": 1, "Face": 1}
+	for _, v := range variants {
+		if v.FuncName != "" {
+			used[v.FuncName]++
+		}
+	}
+	for _, v := range variants {
+		if v.FuncName == "" {
+			used[v.styleName()]++
+		}
+	}
+	for i := range variants {
+		v := &variants[i]
+		if v.FuncName != "" {
+			continue
 		}
+		name := v.styleName()
+		if used[name] > 1 {
+			name = exportName(v.PkgName)
+			for n := 2; used[name] > 0; n++ {
+				name = fmt.Sprintf("%s%d", exportName(v.PkgName), n)
+			}
+		}
+		used[name]++
+		v.FuncName = name
 	}
+}
 
-	inFile, err := f.Open()
-	if err != nil {
-		return fmt.Errorf("opening in-file '%s': %v", fname, err)
+// exportName returns the given name as an exported Go identifier, by removing everything
+// but letters and digits and capitalizing it (ex: "condensed black" would return
+// "CondensedBlack"). It's prefixed with "F" if it would otherwise start with a digit.
+func exportName(s string) string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range s {
+		switch {
+		case ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z'):
+			if upper {
+				r = unicode.ToUpper(r)
+			}
+			sb.WriteRune(r)
+			upper = false
+		case '0' <= r && r <= '9':
+			sb.WriteRune(r)
+			upper = false
+		default:
+			upper = true
+		}
 	}
-	defer inFile.Close()
+	name := sb.String()
+	if name == "" || ('0' <= name[0] && name[0] <= '9') {
+		name = "F" + name
+	}
+	return name
+}
 
-	if err = copyToDisk(inFile, variantDir+"/"+fname); err != nil {
-		return fmt.Errorf("copying font variant file: %w", err)
+// AxesString returns the variant's axis coordinates formatted like "wght=700, wdth=75".
+func (v variantPkgInfo) AxesString() string {
+	coords := make([]string, len(v.Axes))
+	for i, a := range v.Axes {
+		coords[i] = a.Tag + "=" + strconv.FormatFloat(a.Value, 'f', -1, 64)
 	}
+	return strings.Join(coords, ", ")
+}
 
-	// In each font variant Go package, there's a source file named 'data.go' that embeds
-	// and exports its corresponding OTF (or TTF) file content as a byte slice.
-	outGoPath := variantDir + "/data.go"
-	outGoFile, err := os.OpenFile(outGoPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
-	if err != nil {
-		return err
+// HasBlocks reports whether any of the variants are known to cover any Unicode blocks.
+func (fnt *fontPkgInfo) HasBlocks() bool {
+	for _, v := range fnt.Variants {
+		if len(v.Blocks) > 0 {
+			return true
+		}
 	}
-	defer outGoFile.Close()
+	return false
+}
 
-	variant := variantPkgInfo{
-		PkgName:      variantPkgName,
-		FontFileName: fname,
-		DataVarName:  strings.ToUpper(filepath.Ext(fname)[1:]),
+// BlockNames returns the names of the Unicode blocks that the variant covers, separated
+// by commas.
+func (v variantPkgInfo) BlockNames() string {
+	return strings.Join(v.Blocks, ", ")
+}
+
+// Size returns the size of the variant's font file formatted like "1.2 MB", or an empty
+// string for a named instance, which doesn't have one of its own.
+func (v variantPkgInfo) Size() string {
+	if v.FileSize == 0 {
+		return ""
+	}
+	return formatSize(v.FileSize)
+}
+
+// TotalFileSize returns the size in bytes of all of the font files that the package
+// embeds, which is how much it adds to an app that uses all of its variants.
+func (fnt *fontPkgInfo) TotalFileSize() int {
+	total := 0
+	for _, v := range fnt.Variants {
+		total += v.FileSize
 	}
+	return total
+}
 
-	if err = variantPkgCodeTmpl.Execute(outGoFile, &variant); err != nil {
-		return err
+// VersionNumber returns the font's Version without the "Version " prefix and whatever
+// follows the first ";" (ex: "Version 2.010; ttfautohint (v1.8)" would return "2.010"),
+// which name tables often have but which reads badly in the docs.
+func (fnt *fontPkgInfo) VersionNumber() string {
+	v, _, _ := strings.Cut(fnt.Version, ";")
+	v = strings.TrimSpace(v)
+	if len(v) > len("Version ") && strings.EqualFold(v[:len("Version ")], "Version ") {
+		v = strings.TrimSpace(v[len("Version "):])
 	}
+	return v
+}
 
-	fnt.Variants = append(fnt.Variants, variant)
-	return nil
+// TotalSize returns the TotalFileSize formatted like "4.2 MB".
+func (fnt *fontPkgInfo) TotalSize() string {
+	return formatSize(fnt.TotalFileSize())
 }
 
-func writePkgRootFile(fnt *fontPkgInfo) error {
-	f, err := os.OpenFile(fnt.PkgName+".go", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
-	if err != nil {
-		return err
+// formatSize returns the given number of bytes formatted with a decimal unit (ex: "4.2
+// MB").
+func formatSize(n int) string {
+	switch {
+	case n >= 1e6:
+		return fmt.Sprintf("%.1f MB", float64(n)/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1f kB", float64(n)/1e3)
 	}
-	defer f.Close()
+	return fmt.Sprintf("%d B", n)
+}
 
-	if err = rootPkgCodeTmpl.Execute(f, fnt); err != nil {
-		return err
+// Style returns the name of the Gio font.Style constant for the variant (ex: "Italic").
+func (v variantPkgInfo) Style() string {
+	if v.Italic {
+		return "Italic"
 	}
-	return nil
+	return "Regular"
 }
 
-func writeModFile(fnt *fontPkgInfo) error {
-	if _, err := os.Stat("go.mod"); err != nil {
-		if !os.IsNotExist(err) {
-			return err
+// fontFile is a single font that's been loaded from one of the source files, along with
+// the info about the variant package that it's going to be written into.
+type fontFile struct {
+	variant variantPkgInfo
+	data    []byte // The sfnt font data, until it's staged
+
+	// staged is the path of the file that the font data was written into on being
+	// loaded, to be moved into its package from there, or empty with -dry-run.
+	staged    string
+	instances []fontInstance // The font's named instances, with -instances
+}
+
+// loadFontFile reads the given font file and returns each of the fonts that it contains,
+// which is more than one for a font collection. It's safe to call concurrently.
+func loadFontFile(f sourceFile) ([]fontFile, error) {
+	// Fonts from Windows tools sometimes have uppercase extensions (ex: "VEGUR.TTF"), which
+	// are written into the package lowercased.
+	fname := path.Base(f.Path())
+	fname = baseNameStem(fname) + strings.ToLower(path.Ext(fname))
+	b, err := readSourceFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading in-file '%s': %w", fname, err)
+	}
+
+	// Web fonts are decoded back into a plain OTF (or TTF) file so that the embedded
+	// bytes can be loaded directly by Gio's opentype parser.
+	if ext := filepath.Ext(fname); ext == ".woff" || ext == ".woff2" {
+		if ext == ".woff" {
+			b, err = decodeWOFF(b)
+		} else {
+			b, err = decodeWOFF2(b)
 		}
-		if err := exec.Command("go", "mod", "init", fnt.ModPath).Run(); err != nil {
-			return fmt.Errorf("running go mod init: %w", err)
+		if err != nil {
+			return nil, fmt.Errorf("decoding web font '%s': %w", fname, err)
 		}
+		fname = baseNameStem(fname) + "." + sfntExt(b)
 	}
-	if err := exec.Command("go", "mod", "tidy").Run(); err != nil {
-		return fmt.Errorf("running go mod tidy: %w", err)
+
+	if !isCollection(b) {
+		variant, err := newVariantPkgInfo(fname, b)
+		if err != nil {
+			return nil, err
+		}
+		variant.SourcePath = f.Path()
+		return []fontFile{{variant: variant, data: b}}, nil
 	}
-	return nil
+
+	// Each font in a collection gets its own variant package, named after the family and
+	// subfamily in its name table since they all share the collection's file name.
+	split, err := splitCollection(b)
+	if err != nil {
+		return nil, fmt.Errorf("splitting font collection '%s': %w", fname, err)
+	}
+	fonts := make([]fontFile, 0, len(split))
+	for i, fb := range split {
+		md, err := readFontMetadata(fb)
+		if err != nil {
+			return nil, fmt.Errorf("reading font %d of collection '%s': %w", i, fname, err)
+		}
+		name := strings.Replace(md.Family+"-"+md.Subfamily, " ", "", -1)
+		if md.Family == "" || md.Subfamily == "" {
+			name = fmt.Sprintf("%s-%d", baseNameStem(fname), i)
+		}
+		variant, err := newVariantPkgInfo(name+"."+sfntExt(fb), fb)
+		if err != nil {
+			return nil, err
+		}
+		variant.SourcePath = f.Path()
+		fonts = append(fonts, fontFile{variant: variant, data: fb})
+	}
+	return fonts, nil
 }
 
-func copyLicenseFile(fnt *fontPkgInfo, f *zip.File) error {
-	lf, err := f.Open()
+// track records that the given path is about to be created, unless it already exists,
+// so that it can be removed if the run fails. It's safe to call concurrently.
+func (fnt *fontPkgInfo) track(p string) {
+	if _, err := os.Lstat(p); !os.IsNotExist(err) {
+		return
+	}
+	abs, err := filepath.Abs(p)
 	if err != nil {
-		return fmt.Errorf("opening license zip file: %w", err)
+		return
 	}
-	defer lf.Close()
+	fnt.createdMu.Lock()
+	defer fnt.createdMu.Unlock()
+	fnt.created = append(fnt.created, abs)
+}
 
-	if err = copyToDisk(lf, fnt.DirName+"/"+f.Name); err != nil {
-		return err
+// removeCreated removes everything that was recorded with track, in reverse order.
+func (fnt *fontPkgInfo) removeCreated() {
+	for i := len(fnt.created) - 1; i >= 0; i-- {
+		if err := os.RemoveAll(fnt.created[i]); err != nil {
+			warnf("removing partial output: %v", err)
+		}
 	}
+	if len(fnt.created) > 0 {
+		warnf("removed the partial output in '%s' (use -keep-partial to keep it)", fnt.DirName)
+	}
+	fnt.created = nil
+}
 
-	fnt.LicenseFile = f.Name
-	return nil
+// markSeen records that the font data with the given hex SHA-256 hash came from the
+// source file at the given path, unless it's been seen before, in which case it returns
+// the path that it first came from.
+func (fnt *fontPkgInfo) markSeen(sum, srcPath string) (string, bool) {
+	if prev, ok := fnt.seen[sum]; ok {
+		return prev, true
+	}
+	if fnt.seen == nil {
+		fnt.seen = make(map[string]string)
+	}
+	fnt.seen[sum] = srcPath
+	return "", false
 }
 
-func isLicenseFile(fname string) bool {
-	return fname == *licenseFile || strings.ToLower(baseNameStem(fname)) == "ofl"
+// claimPkgName returns the given variant package name if it hasn't been used yet, or
+// otherwise the name with the lowest numeric suffix (starting at 2) that hasn't been, and
+// marks the returned name as used by the source file at the given path.
+func (fnt *fontPkgInfo) claimPkgName(name, srcPath string) string {
+	if fnt.pkgNames == nil {
+		fnt.pkgNames = make(map[string]string)
+	}
+	claimed := name
+	for i := 2; fnt.pkgNames[claimed] != ""; i++ {
+		claimed = fmt.Sprintf("%s%d", name, i)
+	}
+	if claimed != name {
+		warnf("variant package name '%s' of '%s' is already used by '%s', so using '%s' instead", name, srcPath, fnt.pkgNames[name], claimed)
+	}
+	fnt.pkgNames[claimed] = srcPath
+	return claimed
 }
 
-func writeReadme(fnt *fontPkgInfo) error {
-	f, err := os.OpenFile("README.md", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+// newVariantPkgInfo returns the info about the variant package for a single font, where
+// fname is the name of the font file to write into the package and b is its sfnt font
+// data.
+func newVariantPkgInfo(fname string, b []byte) (variantPkgInfo, error) {
+	variantPkgName := sanitizePkgName(baseNameStem(fname))
+
+	// A font that can't be parsed would otherwise only be found out at runtime, by an app
+	// that uses the generated package.
+	f, err := sfnt.Parse(b)
 	if err != nil {
-		return err
+		return variantPkgInfo{}, fmt.Errorf("parsing font '%s': %w", fname, err)
 	}
-	defer f.Close()
 
-	if err = readmeTmpl.Execute(f, fnt); err != nil {
-		return err
+	if safe := sanitizeFileName(fname, variantPkgName); safe != fname {
+		logInfo("writing '%s' as '%s', which can be embedded", fname, safe)
+		fname = safe
 	}
-	return nil
+
+	sum := sha256.Sum256(b)
+	variant := variantPkgInfo{
+		PkgName:      variantPkgName,
+		FontFileName: fname,
+		DataVarName:  strings.ToUpper(filepath.Ext(fname)[1:]),
+		SHA256:       hex.EncodeToString(sum[:]),
+		FileSize:     len(b),
+		Blocks:       coveredBlocks(f),
+	}
+
+	// File names can't always be trusted to describe the font they contain, so the weight
+	// and style are taken from the font's own tables whenever it has them.
+	md, err := readFontMetadata(b)
+	if err != nil {
+		logInfo("reading font tables of '%s': %v", fname, err)
+	}
+	variant.PostScriptName = md.PostScriptName
+	variant.Family = md.Family
+	variant.Version = md.Version
+	variant.Monospace = md.Monospace
+	variant.Weight = md.Weight
+	if variant.Weight == 0 {
+		variant.Weight = weightFromName(baseNameStem(fname))
+	} else if w, ok := nameWeight(baseNameStem(fname)); ok && gioWeight(w) != gioWeight(md.Weight) {
+		// Foundries sometimes mislabel their files, which is worth knowing about before
+		// app developers wonder why the "Medium" variant looks regular.
+		warnf("'%s' is named as %s (%d), but its OS/2 weight class is %d (%s), which is what it's registered as",
+			fname, gioWeight(w), w, md.Weight, gioWeight(md.Weight))
+	}
+	switch {
+	case md.HasStyleBits:
+		variant.Italic = md.Italic
+	case md.Subfamily != "":
+		variant.Italic = italicFromName(md.Subfamily)
+	default:
+		variant.Italic = italicFromName(baseNameStem(fname))
+	}
+	return variant, nil
 }
 
-func initGitAndStageDiff(fnt *fontPkgInfo) error {
-	if _, err := os.Stat(".git"); err != nil {
-		if !os.IsNotExist(err) {
-			return err
+// familyVersion returns the most common version of the given variants, preferring the
+// earliest one on ties, and warns if they don't all have the same version since that
+// usually means that the source mixes up several releases of the font.
+func familyVersion(variants []variantPkgInfo) string {
+	counts := make(map[string]int)
+	var versions []string
+	for _, v := range variants {
+		if v.Version == "" || v.Instance != "" {
+			continue
 		}
-		if err := exec.Command("git", "init").Run(); err != nil {
-			return fmt.Errorf("running 'git init': %w", err)
+		if counts[v.Version] == 0 {
+			versions = append(versions, v.Version)
 		}
-		origin := "git@github.com:gio-tools/font-" + fnt.PkgName + ".git"
-		if err := exec.Command("git", "remote", "add", "origin", origin).Run(); err != nil {
-			return fmt.Errorf("running 'git remote add origin': %w", err)
+		counts[v.Version]++
+	}
+
+	var best string
+	for _, v := range versions {
+		if counts[v] > counts[best] {
+			best = v
 		}
 	}
-	if err := exec.Command("git", "add", "-A").Run(); err != nil {
-		return fmt.Errorf("running 'git add -A': %w", err)
+	if len(versions) > 1 {
+		warnf("the font files have different versions (%s), so the package's version is taken to be '%s'", strings.Join(versions, ", "), best)
 	}
-	return nil
+	return best
 }
 
-func main() {
-	flag.Parse()
+// newInstanceVariant returns the variant for the given named instance of the variable
+// font with the given variant.
+func newInstanceVariant(fnt *fontPkgInfo, base *variantPkgInfo, inst fontInstance) variantPkgInfo {
+	v := *base
+	v.PkgName = fnt.claimPkgName(sanitizePkgName(base.PkgName+inst.Subfamily), base.SourcePath)
+	v.Instance = inst.Subfamily
+	if v.PostScriptName != "" {
+		// This is how Adobe's Technical Note #5902 derives instance names.
+		v.PostScriptName = strings.Split(v.PostScriptName, "-")[0] + "-" + strings.Replace(inst.Subfamily, " ", "", -1)
+	}
+	v.Axes = inst.Coords
+	v.DataPkgName = base.PkgName
+	v.DataPkgPath = fnt.ModPath + "/" + base.PkgName
+	v.HasInstances = false
+	v.FileSize = 0
+	v.FuncName = ""
 
-	zipName := filepath.Base(*zipPath)
-	pkgName := strings.ToLower(baseNameStem(zipName))
-	pkgName = strings.Replace(pkgName, "-", "", -1)
+	v.Weight = inst.weight(base.Weight)
+	v.Italic = inst.italic(base.Italic)
+	return v
+}
 
-	fnt := fontPkgInfo{
-		PkgName: pkgName,
-		ModPath: "gio.tools/fonts/" + pkgName,
-		DirName: "font-" + pkgName,
+// italic reports whether the instance is italic (or oblique) going by its "ital" and
+// "slnt" axis values and its name, or whether the variable font itself is, as given.
+func (inst fontInstance) italic(def bool) bool {
+	// The registered axes are described by the spec at
+	// https://learn.microsoft.com/en-us/typography/opentype/spec/dvaraxisreg.
+	italic := def
+	for _, a := range inst.Coords {
+		switch a.Tag {
+		case "ital":
+			italic = italic || a.Value >= 0.5
+		case "slnt":
+			italic = italic || a.Value != 0
+		}
 	}
+	return italic || italicFromName(inst.Subfamily)
+}
 
-	logInfo("font name '%s'\n", fnt.PkgName)
+// keepsStyle reports whether the variants with the given weight and style are kept,
+// going by -min-weight, -max-weight, -weights and -no-italic.
+func (fnt *fontPkgInfo) keepsStyle(w int, italic bool) bool {
+	if italic && fnt.cfg.NoItalic {
+		return false
+	}
+	if (fnt.cfg.MinWeight > 0 && w < fnt.cfg.MinWeight) || (fnt.cfg.MaxWeight > 0 && w > fnt.cfg.MaxWeight) {
+		return false
+	}
+	if len(fnt.weights) == 0 {
+		return true
+	}
+	for _, kept := range fnt.weights {
+		if w == kept {
+			return true
+		}
+	}
+	return false
+}
 
-	z, err := zip.OpenReader(*zipPath)
-	if err != nil {
-		fatalf("opening zip file: %v", err)
+// parseWeights returns the weights in the given comma-separated list (ex: "400,700").
+func parseWeights(s string) ([]int, error) {
+	var weights []int
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		w, err := strconv.Atoi(f)
+		if err != nil || w < 1 || w > 1000 {
+			return nil, fmt.Errorf("invalid weight '%s' (must be from 1 to 1000)", f)
+		}
+		weights = append(weights, w)
 	}
-	defer z.Close()
+	return weights, nil
+}
 
-	if *zipList {
-		for _, f := range z.File {
-			if !strings.HasPrefix(f.Name, *zipDir) {
-				continue
-			}
-			fmt.Println(f.Name)
+// writeVariantPkg creates the package for the given variant with the given sfnt font
+// data. It's safe to call concurrently.
+func writeVariantPkg(fnt *fontPkgInfo, variant *variantPkgInfo, staged string) error {
+	variantDir := fnt.DirName + "/" + variant.PkgName
+	if fnt.cfg.DryRun {
+		logDryRun("create directory '%s'", variantDir)
+		if variant.DataPkgPath == "" {
+			logDryRun("write '%s'", variantDir+"/"+variant.FontFileName)
 		}
-		return
+		logDryRun("write '%s'", variantDir+"/data.go")
+		return nil
 	}
 
-	// Make the parent output directory.
-	if err = os.Mkdir(fnt.DirName, 0o755); err != nil {
+	fnt.track(variantDir)
+	if err := os.Mkdir(variantDir, 0o755); err != nil {
 		if os.IsExist(err) {
-			logInfo("target output directory '%s' already exists\n", fnt.PkgName)
+			logInfo("directory '%s' already exists", variantDir)
 		} else {
-			fatalf("%v", err)
+			return err
 		}
 	}
 
-	for _, f := range z.File {
-		ext := filepath.Ext(f.Name)
-		if ext != "" {
-			ext = ext[1:]
-		}
-		switch {
-		// The only text file of interest at this point would be a license file.
-		case isLicenseFile(f.Name):
-			if err = copyLicenseFile(&fnt, f); err != nil {
-				fatalf("copying license file: %v", err)
-			}
-		// Create a sub-package for each font variant.
-		case ext == "otf", ext == "ttf":
-			if !strings.HasPrefix(f.Name, *zipDir) {
-				continue
-			}
-			err := createVariantPkg(&fnt, f)
-			if err != nil {
-				fatalf("creating font variant pkg: %v", err)
-			}
-		default:
-			logInfo("skipping file '%s'\n", f.Name)
+	// A named instance has no font file of its own.
+	if variant.DataPkgPath == "" {
+		fnt.track(variantDir + "/" + variant.FontFileName)
+		if err := os.Rename(staged, variantDir+"/"+variant.FontFileName); err != nil {
+			return fmt.Errorf("moving font variant file: %w", err)
 		}
 	}
 
-	sort.SliceStable(fnt.Variants, func(i, j int) bool {
-		return fnt.Variants[i].PkgName < fnt.Variants[j].PkgName
-	})
+	// In each font variant Go package, there's a source file named 'data.go' that embeds
+	// and exports its corresponding OTF (or TTF) file content as a byte slice.
+	data := struct {
+		*variantPkgInfo
+		Header string
+	}{variant, fnt.Header}
+	fnt.track(variantDir + "/data.go")
+	return writeGoFile(variantDir+"/data.go", variantPkgCodeTmpl, &data)
+}
 
-	if err = os.Chdir(fnt.DirName); err != nil {
-		fatalf("cd-ing into font dir: %w", err)
+// writeFlatFontFile writes the font file of the given variant into the directory where
+// it's embedded by the root package itself for -flat or -embed-fs.
+func writeFlatFontFile(fnt *fontPkgInfo, variant *variantPkgInfo, staged string) error {
+	// A named instance has no font file of its own.
+	if variant.DataPkgPath != "" {
+		return nil
+	}
+	p := fnt.fontFilesDir() + "/" + variant.FontFileName
+	if fnt.cfg.DryRun {
+		logDryRun("write '%s'", p)
+		return nil
 	}
+	fnt.track(p)
+	if err := os.Rename(staged, p); err != nil {
+		return fmt.Errorf("moving font variant file: %w", err)
+	}
+	return nil
+}
 
-	if err = writePkgRootFile(&fnt); err != nil {
-		fatalf("writing pkg root file: %v", err)
+// stageFontFile writes the data of the given font into the staging directory under the
+// given name, after reading whatever else is needed from it, and then lets go of it.
+func stageFontFile(fnt *fontPkgInfo, ff *fontFile, stagingDir, name string) error {
+	if fnt.cfg.Instances {
+		var err error
+		if ff.instances, err = readFontInstances(ff.data); err != nil {
+			return fmt.Errorf("reading named instances of '%s': %w", ff.variant.SourcePath, err)
+		}
+	}
+	if fnt.cfg.DryRun {
+		if fnt.ranges != "" {
+			logDryRun("run '%s' on '%s'", subsetCommand, ff.variant.SourcePath)
+		}
+		ff.data = nil
+		return nil
 	}
 
-	if err = writeModFile(&fnt); err != nil {
-		fatalf("%v", err)
+	ff.staged = filepath.Join(stagingDir, name)
+	if err := os.WriteFile(ff.staged, ff.data, 0o644); err != nil {
+		return fmt.Errorf("staging font file: %w", err)
+	}
+	ff.data = nil
+	// The subset font is what's written into the package, so it's what's described too.
+	if fnt.ranges != "" {
+		b, err := subsetFontFile(ff.staged, fnt.ranges)
+		if err != nil {
+			return fmt.Errorf("subsetting '%s': %w", ff.variant.SourcePath, err)
+		}
+		f, err := sfnt.Parse(b)
+		if err != nil {
+			return fmt.Errorf("parsing subset of '%s': %w", ff.variant.SourcePath, err)
+		}
+		sum := sha256.Sum256(b)
+		ff.variant.SHA256 = hex.EncodeToString(sum[:])
+		ff.variant.FileSize = len(b)
+		ff.variant.Blocks = coveredBlocks(f)
 	}
+	return nil
+}
 
-	if err = writeReadme(&fnt); err != nil {
-		fatalf("writing readme: %v", err)
+// fontFilesDir returns the directory that the font files are written into for -flat or
+// -embed-fs.
+func (fnt *fontPkgInfo) fontFilesDir() string {
+	if fnt.EmbedFS {
+		return fnt.DirName + "/assets"
 	}
+	return fnt.DirName
+}
 
-	if err = initGitAndStageDiff(&fnt); err != nil {
-		fatalf("%v", err)
+// runParallel calls fn with each index from 0 to n-1 using the given number of parallel
+// jobs. If any of the calls fail, no further ones are started and the first error is
+// returned.
+func runParallel(n, jobs int, fn func(i int) error) error {
+	work := make(chan int)
+	errs := make(chan error)
+	stop := make(chan struct{})
+
+	go func() {
+		defer close(work)
+		for i := 0; i < n; i++ {
+			select {
+			case work <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(jobs, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				errs <- fn(i)
+			}
+		}()
 	}
+	go func() {
+		wg.Wait()
+		close(errs)
+	}()
 
-	// Make sure there's a file in the website for this font's vanity module path.
-	err = os.WriteFile("../website/content/fonts/"+fnt.PkgName+".md", []byte{}, 0o644)
+	var firstErr error
+	for err := range errs {
+		if err != nil && firstErr == nil {
+			firstErr = err
+			close(stop)
+		}
+	}
+	return firstErr
+}
+
+// createVariantPkgs creates the variant packages for all of the given font files using
+// the given number of parallel jobs, and adds them to the font's variants.
+func createVariantPkgs(fnt *fontPkgInfo, files []sourceFile, jobs int) error {
+	// Each font is written to disk as soon as it's loaded, rather than holding on to all of
+	// them until they're all loaded, since a large family can take up gigabytes.
+	var stagingDir string
+	if !fnt.cfg.DryRun {
+		var err error
+		if stagingDir, err = os.MkdirTemp(fnt.DirName, ".staging-*"); err != nil {
+			return err
+		}
+		fnt.track(stagingDir)
+		defer os.RemoveAll(stagingDir)
+	}
+	loaded := make([][]fontFile, len(files))
+	err := runParallel(len(files), jobs, func(i int) error {
+		var err error
+		if loaded[i], err = loadFontFile(files[i]); err != nil {
+			return err
+		}
+		for j := range loaded[i] {
+			if err := stageFontFile(fnt, &loaded[i][j], stagingDir, fmt.Sprintf("%d-%d", i, j)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		fatalf("making vanity path entry in website: %v", err)
+		return err
 	}
+
+	// Duplicates are skipped and package names are disambiguated in the order of the
+	// source files, rather than whichever order the fonts were loaded in, so that the
+	// output is the same on every run.
+	var fonts []fontFile
+	fileNames := make(map[string]bool)
+	usedOverrides := make(map[string]bool)
+	for _, ffs := range loaded {
+		// The overrides come first, so that the filters go by the overridden weights and
+		// styles too.
+		if err := applyOverride(fnt, ffs, usedOverrides); err != nil {
+			return err
+		}
+		for _, ff := range ffs {
+			// Only the kept instances of a variable font are made into variants, which share
+			// its data, so it's kept as long as any of them are.
+			var insts []fontInstance
+			for _, inst := range ff.instances {
+				if fnt.keepsStyle(inst.weight(ff.variant.Weight), inst.italic(ff.variant.Italic)) {
+					insts = append(insts, inst)
+				} else {
+					logInfo("skipping instance '%s' of '%s' since its weight or style is filtered out", inst.Subfamily, ff.variant.SourcePath)
+				}
+			}
+			if len(insts) == 0 && !fnt.keepsStyle(ff.variant.Weight, ff.variant.Italic) {
+				logInfo("skipping '%s' since its weight or style is filtered out", ff.variant.SourcePath)
+				continue
+			}
+
+			// Some archives contain the same font more than once (like in both a "static"
+			// and a "ttf" directory), which would register the exact same face twice.
+			if prev, seen := fnt.markSeen(ff.variant.SHA256, ff.variant.SourcePath); seen {
+				logInfo("skipping '%s' since it's identical to '%s'", ff.variant.SourcePath, prev)
+				continue
+			}
+			// Names like "Font-Bold.otf" and "FontBold.otf" both end up as "fontbold".
+			ff.variant.PkgName = fnt.claimPkgName(ff.variant.PkgName, ff.variant.SourcePath)
+			if fnt.cfg.VarName != "" {
+				ff.variant.DataVarName = fnt.cfg.VarName
+			}
+			// The embed directives and manifest go by the same name, so they still match
+			// the file on case-sensitive file systems.
+			if fnt.cfg.LowercaseFiles {
+				ff.variant.FontFileName = strings.ToLower(ff.variant.FontFileName)
+			}
+			// All of the font files share one directory with -flat or -embed-fs, where files
+			// from different directories of the source may have the same name.
+			if fnt.Flat || fnt.EmbedFS {
+				if fileNames[ff.variant.FontFileName] {
+					ff.variant.FontFileName = ff.variant.PkgName + path.Ext(ff.variant.FontFileName)
+				}
+				fileNames[ff.variant.FontFileName] = true
+			}
+			if !fnt.cfg.Instances {
+				fonts = append(fonts, ff)
+				continue
+			}
+
+			ff.variant.HasInstances = len(insts) > 0
+			fonts = append(fonts, ff)
+			for _, inst := range insts {
+				fonts = append(fonts, fontFile{variant: newInstanceVariant(fnt, &ff.variant, inst)})
+			}
+		}
+	}
+
+	warnUnusedOverrides(fnt, usedOverrides)
+
+	if len(fonts) == 0 && len(files) > 0 {
+		return errors.New("all of the fonts were filtered out by -min-weight, -max-weight, -weights or -no-italic")
+	}
+
+	if fnt.EmbedFS {
+		if fnt.cfg.DryRun {
+			logDryRun("create directory '%s'", fnt.fontFilesDir())
+		} else {
+			fnt.track(fnt.fontFilesDir())
+			if err := os.MkdirAll(fnt.fontFilesDir(), 0o755); err != nil {
+				return err
+			}
+		}
+	}
+	err = runParallel(len(fonts), jobs, func(i int) error {
+		if fnt.Flat || fnt.EmbedFS {
+			return writeFlatFontFile(fnt, &fonts[i].variant, fonts[i].staged)
+		}
+		return writeVariantPkg(fnt, &fonts[i].variant, fonts[i].staged)
+	})
+	for _, ff := range fonts {
+		fnt.Variants = append(fnt.Variants, ff.variant)
+	}
+	return err
+}
+
+// writePkgRootFile writes the root package's Go file into the given output directory.
+func writePkgRootFile(fnt *fontPkgInfo, dir string) error {
+	if fnt.cfg.DryRun {
+		logDryRun("write '%s'", fnt.DirName+"/"+fnt.PkgName+".go")
+		return nil
+	}
+	tmpl := rootPkgCodeTmpl
+	if fnt.Flat {
+		tmpl = flatPkgCodeTmpl
+	} else if fnt.EmbedFS {
+		tmpl = embedFSPkgCodeTmpl
+	}
+	p := filepath.Join(dir, fnt.PkgName+".go")
+	fnt.track(p)
+	return writeGoFile(p, tmpl, fnt)
+}
+
+// writeVariantFaceFiles writes a file into the root package in the given output directory
+// for each variant with -build-tags (ex: "vegurbold_face.go"), which registers it unless
+// it's left out with its build tag. The suffix keeps the file name from being taken for
+// a GOOS or GOARCH constraint, like for a variant named "linux".
+func writeVariantFaceFiles(fnt *fontPkgInfo, dir string) error {
+	if !fnt.BuildTags {
+		return nil
+	}
+	index := 0
+	for _, v := range fnt.Variants {
+		if v.HasInstances {
+			continue
+		}
+		name := v.PkgName + "_face.go"
+		if fnt.cfg.DryRun {
+			logDryRun("write '%s'", fnt.DirName+"/"+name)
+			index++
+			continue
+		}
+		data := struct {
+			variantPkgInfo
+			Header      string
+			RootPkgName string
+			ModPath     string
+			Format      string
+			Index       int
+		}{v, fnt.Header, fnt.PkgName, fnt.ModPath, strings.ToLower(strings.TrimPrefix(path.Ext(v.FontFileName), ".")), index}
+		p := filepath.Join(dir, name)
+		fnt.track(p)
+		if err := writeGoFile(p, variantFaceTmpl, &data); err != nil {
+			return err
+		}
+		index++
+	}
+	return nil
+}
+
+// FaceCount returns the number of the font's faces, which leaves out the variable fonts
+// that are only there for the data of their named instances.
+func (fnt *fontPkgInfo) FaceCount() int {
+	n := 0
+	for _, v := range fnt.Variants {
+		if !v.HasInstances {
+			n++
+		}
+	}
+	return n
+}
+
+// makeHeader returns the header comment for the font's generated Go files, which is
+// either the text of the -header file or an SPDX line for the font's license.
+func makeHeader(fnt *fontPkgInfo) (string, error) {
+	if fnt.cfg.Header == "" {
+		if fnt.License == "" {
+			return "", nil
+		}
+		return "// SPDX-License-Identifier: " + fnt.License, nil
+	}
+
+	b, err := os.ReadFile(fnt.cfg.Header)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		switch {
+		case strings.HasPrefix(line, "//"):
+			// It's already a comment.
+		case line == "":
+			line = "//"
+		default:
+			line = "// " + line
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func writeFacesTest(fnt *fontPkgInfo, dir string) error {
+	if fnt.cfg.DryRun {
+		logDryRun("write '%s'", fnt.DirName+"/faces_test.go")
+		return nil
+	}
+	p := filepath.Join(dir, "faces_test.go")
+	fnt.track(p)
+	return writeGoFile(p, facesTestTmpl, fnt)
+}
+
+// commandTimeout is how long each of the commands that runCommand runs may take before
+// it's killed, or zero for no limit. It's set from -timeout at the start of a run.
+var commandTimeout time.Duration
+
+// commandContext returns the context to run a command with, which is done once it's
+// taken longer than -timeout.
+func commandContext() (context.Context, context.CancelFunc) {
+	if commandTimeout > 0 {
+		return context.WithTimeout(context.Background(), commandTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// runCommand runs the given command in dir, which is always explicit so that it doesn't
+// depend on the working directory of the process. If it fails, the returned error
+// includes whatever the command printed, since its exit status alone says very little.
+func runCommand(dir, name string, args ...string) error {
+	return runCommandEnv(dir, nil, name, args...)
+}
+
+// runCommandEnv is like runCommand, but also sets the given environment variables (ex:
+// "GIT_AUTHOR_NAME=x") for the command on top of the process's own.
+func runCommandEnv(dir string, env []string, name string, args ...string) error {
+	ctx, cancel := commandContext()
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	// Commands like go start others that would keep the output open after it's killed.
+	cmd.WaitDelay = 5 * time.Second
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("'%s' was killed after taking longer than %v (see -timeout)", strings.Join(append([]string{name}, args...), " "), commandTimeout)
+	}
+	if err != nil {
+		if out := strings.TrimSpace(string(out)); out != "" {
+			return fmt.Errorf("%w\n%s", err, out)
+		}
+		return err
+	}
+	return nil
+}
+
+// writeDoc writes the doc.go file with the root package's comment into the given output
+// directory.
+func writeDoc(fnt *fontPkgInfo, dir string) error {
+	if fnt.cfg.DryRun {
+		logDryRun("write '%s'", fnt.DirName+"/doc.go")
+		return nil
+	}
+	p := filepath.Join(dir, "doc.go")
+	fnt.track(p)
+	return writeGoFile(p, docTmpl, fnt)
+}
+
+// Monospace reports whether all of the font's variants are monospaced, which is what
+// makes it suitable for code or terminals.
+func (fnt *fontPkgInfo) Monospace() bool {
+	for _, v := range fnt.Variants {
+		if !v.Monospace && !v.HasInstances {
+			return false
+		}
+	}
+	return len(fnt.Variants) > 0
+}
+
+// HasMonospace reports whether any of the font's variants are monospaced.
+func (fnt *fontPkgInfo) HasMonospace() bool {
+	for _, v := range fnt.Variants {
+		if v.Monospace && !v.HasInstances {
+			return true
+		}
+	}
+	return false
+}
+
+// RepoName returns the name of the font's repo, which is that of its output directory
+// unless it's given with -out (ex: "font-vegur").
+func (fnt *fontPkgInfo) RepoName() string {
+	return fnt.cfg.DirPrefix + fnt.PkgName
+}
+
+// FamilyNames returns the names of the font families of the variants in the order that
+// they first appear (ex: "Vegur" or "Noto Sans, Noto Sans Mono and Noto Serif"), or an
+// empty string if none of them have one.
+func (fnt *fontPkgInfo) FamilyNames() string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, v := range fnt.Variants {
+		if v.Family != "" && !seen[v.Family] {
+			names = append(names, v.Family)
+			seen[v.Family] = true
+		}
+	}
+	if len(names) <= 1 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+func writeExampleTest(fnt *fontPkgInfo, dir string) error {
+	if fnt.cfg.DryRun {
+		logDryRun("write '%s'", fnt.DirName+"/example_test.go")
+		return nil
+	}
+	p := filepath.Join(dir, "example_test.go")
+	fnt.track(p)
+	return writeGoFile(p, exampleTestTmpl, fnt)
+}
+
+// writeModFile sets up the module in the given output directory with the go command.
+func writeModFile(fnt *fontPkgInfo, dir string) error {
+	if fnt.cfg.NoMod {
+		fmt.Fprintf(out, "skipping go.mod setup; run 'go mod init %s' and 'go mod tidy' in '%s' yourself\n", fnt.ModPath, fnt.DirName)
+		return nil
+	}
+
+	// An existing module is left as is, since it may be part of a larger setup (like a
+	// workspace) that this can't know about.
+	modFile := filepath.Join(dir, "go.mod")
+	if _, err := os.Stat(modFile); err == nil {
+		fmt.Fprintf(out, "skipping go.mod setup since it already exists; run 'go mod tidy' in '%s' yourself if needed\n", fnt.DirName)
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if fnt.cfg.DryRun {
+		logDryRun("run 'go mod init %s' and 'go mod tidy' in '%s'", fnt.ModPath, fnt.DirName)
+		if fnt.cfg.GoVersion != "" {
+			logDryRun("set the go directive of '%s' to %s", fnt.DirName+"/go.mod", fnt.cfg.GoVersion)
+		}
+		if fnt.cfg.GioVersion != "" {
+			logDryRun("require gioui.org %s in '%s'", fnt.cfg.GioVersion, fnt.DirName+"/go.mod")
+		}
+		if fnt.cfg.Download {
+			logDryRun("run 'go mod download' in '%s'", fnt.DirName)
+		}
+		return nil
+	}
+	fnt.track(modFile)
+	fnt.track(filepath.Join(dir, "go.sum"))
+	if err := runCommand(dir, "go", "mod", "init", fnt.ModPath); err != nil {
+		return fmt.Errorf("running go mod init: %w", err)
+	}
+	// go mod init uses the local toolchain's version, which would make the output depend
+	// on whoever generated it.
+	if fnt.cfg.GoVersion != "" {
+		if err := runCommand(dir, "go", "mod", "edit", "-go="+fnt.cfg.GoVersion); err != nil {
+			return fmt.Errorf("setting the go version: %w", err)
+		}
+	}
+	// Likewise, go mod tidy would otherwise pick the latest version of Gio, but it keeps a
+	// version that's already required.
+	if fnt.cfg.GioVersion != "" {
+		if err := runCommand(dir, "go", "mod", "edit", "-require=gioui.org@"+fnt.cfg.GioVersion); err != nil {
+			return fmt.Errorf("setting the gio version: %w", err)
+		}
+	}
+	if err := runCommand(dir, "go", "mod", "tidy"); err != nil {
+		return fmt.Errorf("running go mod tidy: %w", err)
+	}
+	// This makes sure go.sum has the hashes of everything needed to build and test the
+	// package, even with other dependencies than tidy happened to look at.
+	if fnt.cfg.Download {
+		if err := runCommand(dir, "go", "mod", "download"); err != nil {
+			return fmt.Errorf("running go mod download: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkBuild builds all of the packages in the given output directory with -build-check,
+// to catch a template or metadata that generates Go code that doesn't compile before the
+// package is handed off.
+func checkBuild(fnt *fontPkgInfo, dir string) error {
+	if !fnt.cfg.BuildCheck {
+		return nil
+	}
+	if fnt.cfg.DryRun {
+		logDryRun("run 'go build ./...' in '%s'", fnt.DirName)
+		return nil
+	}
+	if err := runCommand(dir, "go", "build", "./..."); err != nil {
+		return fmt.Errorf("the generated package doesn't build: %w", err)
+	}
+	logInfo("checked that '%s' builds", fnt.DirName)
+	return nil
+}
+
+// checkWritable returns an error if new files can't be created in the given directory.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".mkfontpkg-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// prepareExistingDir handles an output directory that already exists with the given
+// entries, according to the -force and -fail-on-exist flags.
+func prepareExistingDir(cfg *config, dir string, entries []os.DirEntry) error {
+	switch {
+	case len(entries) == 0:
+		return nil
+	case cfg.FailOnExist:
+		return fmt.Errorf("output directory '%s' already contains files", dir)
+	case !cfg.Force:
+		warnf("output directory '%s' already contains files, so any stale variant packages from a previous run may remain (use -force to clear it first)", dir)
+		return nil
+	}
+
+	// The git history and the changelog are kept so that regenerating a font's existing
+	// repo shows what changed.
+	for _, e := range entries {
+		if e.Name() == ".git" || e.Name() == changelogFileName {
+			continue
+		}
+		p := filepath.Join(dir, e.Name())
+		if cfg.DryRun {
+			logDryRun("remove '%s'", p)
+		} else if err := os.RemoveAll(p); err != nil {
+			return fmt.Errorf("clearing output directory: %w", err)
+		}
+	}
+	return nil
+}
+
+func copyLicenseFile(fnt *fontPkgInfo, f sourceFile) error {
+	// License files are often in a sub-directory alongside the fonts, but they're always
+	// copied into the root of the package.
+	name := path.Base(f.Path())
+	for _, lf := range fnt.LicenseFiles {
+		if lf == name {
+			logInfo("skipping duplicate license file '%s'", f.Path())
+			return nil
+		}
+	}
+
+	text, err := readSourceFile(f)
+	if err != nil {
+		return fmt.Errorf("reading license file: %w", err)
+	}
+	text = normalizeEOL(fnt, f.Path(), text)
+
+	// The license is still detected when it isn't copied, since it's recorded elsewhere.
+	if fnt.cfg.ExcludeLicense {
+		logInfo("not copying license file '%s' since -exclude-license was given", f.Path())
+	} else if fnt.cfg.DryRun {
+		logDryRun("write '%s'", fnt.DirName+"/"+name)
+	} else {
+		fnt.track(fnt.DirName + "/" + name)
+		if err = copyToDisk(bytes.NewReader(text), fnt.DirName+"/"+name); err != nil {
+			return err
+		}
+	}
+
+	if !fnt.cfg.ExcludeLicense {
+		fnt.LicenseFiles = append(fnt.LicenseFiles, name)
+	}
+	preferred := false
+	if rank := licenseRank(f.Path(), fnt.cfg.LicenseFile); fnt.LicenseFile == "" || rank < fnt.licenseRank {
+		fnt.LicenseFile = name
+		fnt.licenseRank = rank
+		preferred = true
+	}
+	if id := detectLicense(text); id != "" && (preferred || fnt.License == "") {
+		fnt.License = id
+	}
+	return nil
+}
+
+// rootLicenseNames are the file names that pkg.go.dev and GitHub look for a license in at
+// the root of a repo.
+var rootLicenseNames = []string{"LICENSE", "LICENSE.md", "LICENSE.txt", "LICENCE", "LICENCE.md", "LICENCE.txt", "COPYING", "COPYING.md", "COPYING.txt"}
+
+// writeRootLicense writes a copy of the preferred license file as "LICENSE", unless one of
+// the copied license files already has one of the rootLicenseNames, since pkg.go.dev
+// otherwise doesn't find the license of a font whose license file is named something like
+// "OFL.txt", and then doesn't show the package's documentation. It's a copy rather than a
+// symlink, which git on Windows would check out as a plain text file of its target path.
+func writeRootLicense(fnt *fontPkgInfo) error {
+	if fnt.cfg.ExcludeLicense || fnt.LicenseFile == "" {
+		return nil
+	}
+	for _, lf := range fnt.LicenseFiles {
+		for _, name := range rootLicenseNames {
+			if lf == name {
+				return nil
+			}
+		}
+	}
+
+	p := fnt.DirName + "/LICENSE"
+	if fnt.cfg.DryRun {
+		logDryRun("write '%s'", p)
+		return nil
+	}
+	text, err := os.ReadFile(fnt.DirName + "/" + fnt.LicenseFile)
+	if err != nil {
+		return err
+	}
+	logInfo("copying '%s' to 'LICENSE' for pkg.go.dev and GitHub to find", fnt.LicenseFile)
+	fnt.track(p)
+	return copyToDisk(bytes.NewReader(text), p)
+}
+
+// normalizeEOL returns the given content of a copied source file with its CRLF line
+// endings replaced by LFs, unless that's turned off with -normalize-eol=false, so that
+// the text files of the package are consistent even if the foundry zipped them up on
+// Windows. Font files and anything else that doesn't look like text are left as is.
+func normalizeEOL(fnt *fontPkgInfo, p string, b []byte) []byte {
+	if !fnt.cfg.NormalizeEOL || isFontFile(p) || bytes.IndexByte(b, 0) >= 0 || !utf8.Valid(b) {
+		return b
+	}
+	if !bytes.Contains(b, []byte("\r\n")) {
+		return b
+	}
+	logInfo("converting the CRLF line endings of '%s' to LF", p)
+	return bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+}
+
+// copyExtraFile copies the given file into the root of the package as is, unless its name
+// is taken by another copied or generated file.
+func copyExtraFile(fnt *fontPkgInfo, f sourceFile) error {
+	name := path.Base(f.Path())
+	taken := append(append([]string{
+		"README.md", "LICENSE", changelogFileName, ".gitignore", "go.mod", "go.sum", "doc.go", "faces_test.go", "example_test.go", manifestFileName, fnt.PkgName + ".go",
+	}, fnt.LicenseFiles...), fnt.ExtraFiles...)
+	for _, t := range taken {
+		if t == name {
+			warnf("skipping extra file '%s' since the package already has a '%s'", f.Path(), name)
+			return nil
+		}
+	}
+
+	text, err := readSourceFile(f)
+	if err != nil {
+		return err
+	}
+	text = normalizeEOL(fnt, f.Path(), text)
+	if fnt.cfg.DryRun {
+		logDryRun("write '%s'", fnt.DirName+"/"+name)
+	} else {
+		fnt.track(fnt.DirName + "/" + name)
+		if err = copyToDisk(bytes.NewReader(text), fnt.DirName+"/"+name); err != nil {
+			return err
+		}
+	}
+	fnt.ExtraFiles = append(fnt.ExtraFiles, name)
+	return nil
+}
+
+// copySrcFile copies the given source file into the package's SrcDir at the same path
+// that it has within the source.
+func copySrcFile(fnt *fontPkgInfo, f sourceFile) error {
+	name := path.Clean(f.Path())
+	if !fs.ValidPath(name) {
+		warnf("not keeping '%s' since its path leads outside of the source", f.Path())
+		return nil
+	}
+	diskPath := filepath.Join(fnt.DirName, fnt.SrcDir, filepath.FromSlash(name))
+	if fnt.cfg.DryRun {
+		logDryRun("write '%s'", diskPath)
+		return nil
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	fnt.track(filepath.Join(fnt.DirName, fnt.SrcDir))
+	if err := os.MkdirAll(filepath.Dir(diskPath), 0o755); err != nil {
+		return err
+	}
+	return copyToDisk(r, diskPath)
+}
+
+// LicenseName returns the full name of the package's license (ex: "SIL Open Font License
+// 1.1"), or an empty string if it wasn't recognized.
+func (fnt *fontPkgInfo) LicenseName() string {
+	for _, l := range knownLicenses {
+		if l.id == fnt.License {
+			return l.name
+		}
+	}
+	return ""
+}
+
+// licenseNames are the base name stems (ignoring case) of well-known license files, in
+// order of preference. The names of specific licenses come before the generic ones since
+// they say which license the file actually contains.
+var licenseNames = []string{"ofl", "ufl", "apache", "mit", "license", "licence", "copying"}
+
+// licenseRank returns the preference of the given file as the font's license file, with
+// lower being better, or -1 if it isn't a license file. The given -license file always
+// comes first, and other names may be followed by a version (ex: "OFL-1.1.txt").
+func licenseRank(fname, licenseFile string) int {
+	if fname == licenseFile {
+		return 0
+	}
+	stem := strings.ToLower(baseNameStem(path.Base(fname)))
+	for i, name := range licenseNames {
+		if stem == name {
+			return i + 1
+		}
+		if v, ok := strings.CutPrefix(stem, name+"-"); ok && v != "" && strings.Trim(v, "0123456789.") == "" {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func isLicenseFile(fname, licenseFile string) bool {
+	return licenseRank(fname, licenseFile) >= 0
+}
+
+func writeReadme(fnt *fontPkgInfo, dir string) error {
+	if fnt.cfg.DryRun {
+		logDryRun("write '%s'", fnt.DirName+"/README.md")
+		return nil
+	}
+	p := filepath.Join(dir, "README.md")
+	fnt.track(p)
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = readmeTmpl.Execute(f, fnt); err != nil {
+		return err
+	}
+	return nil
+}
+
+// writeGitignore writes the .gitignore file into the given output directory, unless it's
+// turned off with -no-gitignore.
+func writeGitignore(fnt *fontPkgInfo, dir string) error {
+	if fnt.cfg.NoGitignore {
+		return nil
+	}
+	if fnt.cfg.DryRun {
+		logDryRun("write '%s'", fnt.DirName+"/.gitignore")
+		return nil
+	}
+	p := filepath.Join(dir, ".gitignore")
+	fnt.track(p)
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gitignoreTmpl.Execute(f, fnt)
+}
+
+// runPostHook runs the -post-hook shell command in the given output directory, once the
+// package has been generated. Unlike the other commands, its output is shown as it runs,
+// since it's up to the user what it does. The package's info is passed to it in the
+// environment (ex: MKFONTPKG_MODULE=gio.tools/fonts/vegur).
+func runPostHook(fnt *fontPkgInfo, dir string) error {
+	hook := fnt.cfg.PostHook
+	if hook == "" {
+		return nil
+	}
+	if fnt.cfg.DryRun {
+		logDryRun("run the post-hook '%s' in '%s'", hook, fnt.DirName)
+		return nil
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	cmd := exec.CommandContext(ctx, shell, flag, hook)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"MKFONTPKG_PKG="+fnt.PkgName,
+		"MKFONTPKG_MODULE="+fnt.ModPath,
+		"MKFONTPKG_DIR="+dir,
+		"MKFONTPKG_VERSION="+fnt.Version,
+	)
+	// The hook's stdout is discarded along with the summary with -quiet or -json, while
+	// its stderr always goes to stderr.
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	cmd.WaitDelay = 5 * time.Second
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("it was killed after taking longer than %v (see -timeout)", commandTimeout)
+	}
+	return err
+}
+
+// sourceDateEpoch returns the time in the SOURCE_DATE_EPOCH environment variable and true
+// if it's set, or else the current time, which is the standard way of making the output
+// of tools reproducible (see https://reproducible-builds.org/specs/source-date-epoch/).
+func sourceDateEpoch() (time.Time, bool, error) {
+	s := os.Getenv("SOURCE_DATE_EPOCH")
+	if s == "" {
+		return time.Now().UTC().Truncate(time.Second), false, nil
+	}
+	secs, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || secs < 0 {
+		return time.Time{}, false, fmt.Errorf("SOURCE_DATE_EPOCH '%s' isn't a number of seconds since the Unix epoch", s)
+	}
+	return time.Unix(secs, 0).UTC(), true, nil
+}
+
+// fixModTimes sets the modification times of all of the files and directories in the
+// given output directory but .git to the SOURCE_DATE_EPOCH, if it's set, so that the
+// generated tree is the same on every run, down to its metadata.
+func fixModTimes(fnt *fontPkgInfo, dir string) error {
+	if !fnt.fixedTime || fnt.cfg.DryRun {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		return os.Chtimes(p, fnt.generated, fnt.generated)
+	})
+}
+
+// initGitAndStageDiff makes the given output directory a git repo if it isn't one yet,
+// and stages all of its changes, which are then committed with -commit.
+func initGitAndStageDiff(fnt *fontPkgInfo, dir string) error {
+	if fnt.cfg.NoGit {
+		return nil
+	}
+	if fnt.cfg.DryRun {
+		logDryRun("run 'git init' in '%s' if it isn't a repo yet", fnt.DirName)
+		if fnt.RemoteURL != "" {
+			logDryRun("run 'git remote add origin %s' in '%s' if it isn't a repo yet", fnt.RemoteURL, fnt.DirName)
+		}
+		logDryRun("run 'git add -A' in '%s'", fnt.DirName)
+		if fnt.cfg.Commit {
+			logDryRun("run 'git commit' in '%s' with the message '%s'", fnt.DirName, fnt.cfg.CommitMessage)
+		}
+		return nil
+	}
+	gitDir := filepath.Join(dir, ".git")
+	if _, err := os.Stat(gitDir); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		fnt.track(gitDir)
+		if err := runCommand(dir, "git", "init"); err != nil {
+			return fmt.Errorf("running 'git init': %w", err)
+		}
+		if fnt.RemoteURL != "" {
+			if err := runCommand(dir, "git", "remote", "add", "origin", fnt.RemoteURL); err != nil {
+				return fmt.Errorf("running 'git remote add origin': %w", err)
+			}
+		}
+	}
+	if err := runCommand(dir, "git", "add", "-A"); err != nil {
+		return fmt.Errorf("running 'git add -A': %w", err)
+	}
+	if !fnt.cfg.Commit {
+		return nil
+	}
+	// Regenerating a package the same as before leaves nothing to commit, which git
+	// treats as an error.
+	if err := runCommand(dir, "git", "diff", "--cached", "--quiet"); err == nil {
+		logInfo("nothing changed in '%s' since its last commit", fnt.DirName)
+		return nil
+	}
+	// The identity is given through the environment, which wins over both the git config
+	// and whatever identity the process's own environment has.
+	var env []string
+	if name := fnt.cfg.GitAuthor; name != "" {
+		env = append(env, "GIT_AUTHOR_NAME="+name, "GIT_COMMITTER_NAME="+name)
+	}
+	if email := fnt.cfg.GitEmail; email != "" {
+		env = append(env, "GIT_AUTHOR_EMAIL="+email, "GIT_COMMITTER_EMAIL="+email)
+	}
+	if err := runCommandEnv(dir, env, "git", "commit", "-q", "-m", fnt.cfg.CommitMessage); err != nil {
+		return fmt.Errorf("running 'git commit': %w", err)
+	}
+	return nil
+}
+
+// listFiles prints each of the given font files with the info that's read from them, and
+// each of the license files with the license it contains.
+func listFiles(cfg *config, files []sourceFile) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+	// Every row has the same number of cells, since tabwriter only aligns the columns of
+	// adjacent rows that have them.
+	fmt.Fprintln(tw, "FILE\tTYPE\tFAMILY\tSUBFAMILY\tWEIGHT\tSTYLE")
+	for _, f := range files {
+		if !inZipDir(cfg.ZipDir, f.Path()) {
+			continue
+		}
+		switch {
+		case isLicenseFile(f.Path(), cfg.LicenseFile):
+			license := "unrecognized"
+			if text, err := readSourceFile(f); err != nil {
+				license = fmt.Sprintf("error: %v", err)
+			} else if id := detectLicense(text); id != "" {
+				license = id
+			}
+			fmt.Fprintf(tw, "%s\tlicense\t%s\t\t\t\n", f.Path(), license)
+		case isFontFile(f.Path()):
+			ext := strings.ToLower(path.Ext(f.Path())[1:])
+			fonts, err := loadFontFile(f)
+			if err != nil {
+				fmt.Fprintf(tw, "%s\t%s\terror: %v\t\t\t\n", f.Path(), ext, err)
+				continue
+			}
+			for _, ff := range fonts {
+				md, _ := readFontMetadata(ff.data)
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d (%s)\t%s\n", f.Path(), ext, md.Family, md.Subfamily,
+					ff.variant.Weight, ff.variant.GioWeight(), ff.variant.Style())
+			}
+		}
+	}
+}
+
+// printSummary prints what was generated for the font, regardless of -v.
+func printSummary(fnt *fontPkgInfo) {
+	// The data of a variable font with named instances is listed, but it isn't a face of
+	// its own, so the count is of the faces of the collection.
+	fmt.Fprintf(out, "package %s (%s) in '%s' with %d faces:\n", fnt.PkgName, fnt.ModPath, fnt.DirName, fnt.FaceCount())
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, v := range fnt.Variants {
+		var cells []string
+		switch {
+		case v.HasInstances:
+			cells = []string{v.PkgName, "variable font data", "", ""}
+		case v.Instance != "":
+			cells = []string{v.PkgName, v.GioWeight(), v.Style(), "(" + v.AxesString() + ")"}
+		default:
+			cells = []string{v.PkgName, v.GioWeight(), v.Style(), ""}
+		}
+		// The size of each of the font files is only of interest with -v.
+		if fnt.cfg.Verbose {
+			cells = append(cells, v.Size())
+		}
+		for len(cells) > 0 && cells[len(cells)-1] == "" {
+			cells = cells[:len(cells)-1]
+		}
+		fmt.Fprintf(tw, "  %s\n", strings.Join(cells, "\t"))
+	}
+	tw.Flush()
+	fmt.Fprintf(out, "embeds %s of font data\n", fnt.TotalSize())
+
+	switch {
+	case fnt.LicenseFile == "":
+		fmt.Fprintln(out, "license: NONE FOUND - the font may not be redistributable without one")
+	case fnt.License == "":
+		fmt.Fprintf(out, "license: unrecognized (%s)\n", fnt.LicenseFile)
+	default:
+		fmt.Fprintf(out, "license: %s (%s)\n", fnt.License, fnt.LicenseFile)
+	}
+}
+
+// inZipDir reports whether the given slash-separated path is within the given -zipdir
+// directory, which it always is if that's empty. A path like "fonts-extra/a.ttf"
+// isn't within "fonts", even though it has the same prefix.
+func inZipDir(zipDir, p string) bool {
+	dir := path.Clean("/" + zipDir)
+	if dir == "/" {
+		return true
+	}
+	return strings.HasPrefix(path.Clean("/"+p), dir+"/")
+}
+
+// isFontFile reports whether the given file is one of the supported font file types.
+func isFontFile(fname string) bool {
+	switch strings.ToLower(path.Ext(fname)) {
+	case ".otf", ".ttf", ".ttc", ".otc", ".woff", ".woff2":
+		return true
+	}
+	return false
+}
+
+// preferFormat returns the given font files without those that have the same face as one
+// with the preferred extension (ex: "otf"), which is taken to be the case if their file
+// names are the same but for the extension. So "otf/Vegur-Bold.otf" would be kept over
+// "ttf/Vegur-Bold.ttf", but "Vegur.ttf" is kept if there's no "Vegur.otf".
+func preferFormat(files []sourceFile, ext string) []sourceFile {
+	face := func(f sourceFile) string {
+		return sanitizePkgName(baseNameStem(path.Base(f.Path())))
+	}
+	preferred := make(map[string]string)
+	for _, f := range files {
+		if strings.EqualFold(path.Ext(f.Path()), "."+ext) {
+			if _, ok := preferred[face(f)]; !ok {
+				preferred[face(f)] = f.Path()
+			}
+		}
+	}
+
+	var kept []sourceFile
+	for _, f := range files {
+		if p, ok := preferred[face(f)]; ok && !strings.EqualFold(path.Ext(f.Path()), "."+ext) {
+			logInfo("skipping '%s' since '%s' has the same face in the preferred format", f.Path(), p)
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// familyName returns the typographic family name of the first of the given files that's
+// a font file within the given -zipdir directory.
+func familyName(files []sourceFile, zipDir string) (string, error) {
+	for _, f := range files {
+		if !isFontFile(f.Path()) || !inZipDir(zipDir, f.Path()) {
+			continue
+		}
+		fonts, err := loadFontFile(f)
+		if err != nil {
+			return "", err
+		}
+		md, err := readFontMetadata(fonts[0].data)
+		if err != nil {
+			return "", fmt.Errorf("reading font tables of '%s': %w", f.Path(), err)
+		}
+		if md.Family == "" {
+			return "", fmt.Errorf("font '%s' has no family name", f.Path())
+		}
+		return md.Family, nil
+	}
+	return "", errors.New("no font files found")
+}
+
+func main() {
+	var cfg config
+	cfg.registerFlags(flag.CommandLine)
+	printVersion := flag.Bool("version", false, "print the version of this tool and exit")
+	configPath := flag.String("config", "", "path of a JSON config file with the default values of the flags, keyed by their names (default '"+configFileName+"' in the working directory, if there is one)")
+	flag.Parse()
+
+	if *printVersion {
+		fmt.Println("mkfontpkg", toolVersion())
+		return
+	}
+	if *configPath != "" {
+		if err := loadConfigFile(flag.CommandLine, *configPath, true); err != nil {
+			fatalf("%v", err)
+		}
+	} else if err := loadConfigFile(flag.CommandLine, configFileName, false); err != nil {
+		fatalf("%v", err)
+	}
+
+	paths, err := archivePaths(cfg.ZipPaths)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if len(paths) <= 1 {
+		if len(paths) == 1 {
+			cfg.ZipPath = paths[0]
+		}
+		if err := run(cfg); err != nil {
+			fatalf("%v", err)
+		}
+		return
+	}
+	if err := runAll(cfg, paths); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// printVariantPkg prints the data.go of the variant package for the single font in the
+// -font file, or on stdin if there isn't one, for -stdout. It's for embedding a one-off
+// font in an app's own package, so it goes through none of the rest of generating a font
+// package, and the font file has to be put next to it under the name that it embeds.
+func printVariantPkg(cfg *config) error {
+	var f sourceFile
+	if cfg.Font == "" || cfg.Font == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("reading font from stdin: %w", err)
+		}
+		// There's no file name to go by, so the format is told by the data itself.
+		ext := sfntExt(b)
+		if bytes.HasPrefix(b, []byte("wOFF")) || bytes.HasPrefix(b, []byte("wOF2")) {
+			ext = "woff"
+		}
+		f = memSourceFile{path: "font." + ext, data: b}
+	} else {
+		f = dirSourceFile{root: filepath.Dir(cfg.Font), path: filepath.Base(cfg.Font)}
+		if !isFontFile(f.Path()) {
+			return fmt.Errorf("'%s' isn't an OTF, TTF or TTC file", cfg.Font)
+		}
+	}
+	// Web fonts would only be decoded in memory, which leaves nothing for the printed
+	// data.go to embed.
+	if ext := strings.ToLower(path.Ext(f.Path())); ext == ".woff" || ext == ".woff2" {
+		return errors.New("-stdout can't take a web font, which has to be decoded into an OTF or TTF file to be embedded")
+	}
+
+	fonts, err := loadFontFile(f)
+	if err != nil {
+		return err
+	}
+	if len(fonts) != 1 {
+		return fmt.Errorf("-stdout takes a single font, but '%s' is a collection of %d", f.Path(), len(fonts))
+	}
+	variant := fonts[0].variant
+	if cfg.Name != "" {
+		variant.PkgName = cfg.Name
+	}
+	if cfg.VarName != "" {
+		variant.DataVarName = cfg.VarName
+	}
+	if _, ok := f.(memSourceFile); ok || variant.FontFileName != f.Path() {
+		warnf("the font file has to be saved as '%s' next to the printed data.go, which embeds it under that name", variant.FontFileName)
+	}
+
+	header, err := makeHeader(&fontPkgInfo{cfg: cfg})
+	if err != nil {
+		return fmt.Errorf("reading header file: %w", err)
+	}
+	data := struct {
+		*variantPkgInfo
+		Header string
+	}{&variant, header}
+	src, err := executeGoTemplate(variantPkgCodeTmpl, &data)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(src)
+	return err
+}
+
+// regenerateReadme writes the README of an existing package again from its manifest,
+// which is in the -out directory or else that of the -name package.
+func regenerateReadme(cfg *config) error {
+	dir := filepath.Clean(cfg.OutDir)
+	if cfg.OutDir == "" && cfg.Name != "" {
+		dir = cfg.DirPrefix + cfg.Name
+	} else if cfg.OutDir == "" {
+		return errors.New("-init-readme-only needs the package's directory with -out, or its name with -name")
+	}
+	m, err := readManifest(dir)
+	if err != nil {
+		return fmt.Errorf("reading manifest: %w", err)
+	} else if m == nil {
+		return fmt.Errorf("there's no %s in '%s' to regenerate the README from", manifestFileName, dir)
+	}
+	fnt, err := m.fontPkgInfo(cfg, dir)
+	if err != nil {
+		return err
+	}
+
+	outDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := writeReadme(fnt, outDir); err != nil {
+		return fmt.Errorf("writing readme: %w", err)
+	}
+	if !cfg.DryRun {
+		fmt.Fprintf(out, "regenerated '%s'\n", filepath.Join(dir, "README.md"))
+	}
+	return nil
+}
+
+// archivePaths returns the archives given with -zip, where each directory is replaced by
+// the archives that it contains.
+func archivePaths(zips []string) ([]string, error) {
+	var paths []string
+	for _, p := range zips {
+		fi, err := os.Stat(p)
+		if p == "-" || err != nil || !fi.IsDir() {
+			paths = append(paths, p)
+			continue
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		n := len(paths)
+		for _, e := range entries {
+			switch name := strings.ToLower(e.Name()); {
+			case e.IsDir():
+			case strings.HasSuffix(name, ".zip"), strings.HasSuffix(name, ".tar"),
+				strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+				paths = append(paths, filepath.Join(p, e.Name()))
+			}
+		}
+		if len(paths) == n {
+			return nil, fmt.Errorf("directory '%s' doesn't contain any archives", p)
+		}
+	}
+	for _, p := range paths {
+		if p == "-" && len(paths) > 1 {
+			return nil, errors.New("stdin can't be read along with other archives")
+		}
+	}
+	return paths, nil
+}
+
+// runAll generates a font package from each of the given archives in turn with the same
+// config. It stops at the first one that fails unless -keep-going is given, in which case
+// it reports which ones did once it's done with all of them.
+func runAll(cfg config, paths []string) error {
+	if cfg.Name != "" || cfg.OutDir != "" || cfg.SHA256 != "" {
+		return errors.New("-name, -out and -sha256 can't be given with more than one archive")
+	}
+
+	errs := make([]error, len(paths))
+	var failed int
+	for i, p := range paths {
+		c := cfg
+		c.ZipPath = p
+		if errs[i] = run(c); errs[i] != nil {
+			if !cfg.KeepGoing {
+				return fmt.Errorf("%s: %w", p, errs[i])
+			}
+			logError("%s: %v", p, errs[i])
+			failed++
+		}
+	}
+
+	fmt.Fprintln(out)
+	for i, p := range paths {
+		if errs[i] != nil {
+			fmt.Fprintf(out, "FAILED  %s: %v\n", p, errs[i])
+		} else {
+			fmt.Fprintf(out, "ok      %s\n", p)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d archives failed", failed, len(paths))
+	}
+	return nil
+}
+
+// run generates the font package according to the given config.
+func run(cfg config) (err error) {
+	if cfg.Quiet && cfg.Verbose {
+		return errors.New("only one of -quiet or -v may be given")
+	} else if cfg.JSON && cfg.Verbose {
+		return errors.New("only one of -json or -v may be given")
+	}
+	level := slog.LevelWarn
+	if cfg.Verbose {
+		level = slog.LevelInfo
+	} else if cfg.Quiet || cfg.JSON {
+		level = slog.LevelError
+		out = io.Discard
+	}
+	l, err := newLogger(os.Stderr, cfg.LogFormat, cfg.LogLevel, level)
+	if err != nil {
+		return err
+	}
+	logger = l
+	// The warnings go in the result instead with -json, leaving only errors on stderr.
+	var warnings *warningCollector
+	if cfg.JSON {
+		warnings = newWarningCollector(l.Handler())
+		logger = slog.New(warnings)
+	}
+	if cfg.Timeout < 0 {
+		return errors.New("-timeout can't be negative")
+	}
+	commandTimeout = cfg.Timeout
+	if cfg.JSON && (cfg.List || cfg.ZipList || cfg.InitReadmeOnly || cfg.Stdout) {
+		return errors.New("-json can't be given with -list, -zipls, -init-readme-only or -stdout")
+	}
+	if err := loadTemplates(cfg.TemplatesDir); err != nil {
+		return fmt.Errorf("loading templates: %w", err)
+	}
+	if cfg.InitReadmeOnly {
+		return regenerateReadme(&cfg)
+	}
+
+	if strings.ContainsAny(cfg.DirPrefix, `/\`) {
+		return fmt.Errorf("-dirprefix '%s' can't contain path separators (give -out for the whole path)", cfg.DirPrefix)
+	}
+	if cfg.LicenseURL != "" {
+		if u, err := url.Parse(cfg.LicenseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("-license-url '%s' isn't an http or https URL", cfg.LicenseURL)
+		}
+	}
+	if cfg.ZipPath != "" && cfg.DirPath != "" {
+		return errors.New("only one of -zip or -dir may be given")
+	}
+	if cfg.VarName != "" && (!token.IsIdentifier(cfg.VarName) || !token.IsExported(cfg.VarName)) {
+		return fmt.Errorf("-varname '%s' is not an exported Go identifier", cfg.VarName)
+	}
+
+	switch {
+	case cfg.Name != "":
+		if !token.IsIdentifier(cfg.Name) {
+			return fmt.Errorf("-name '%s' is not a valid Go package name", cfg.Name)
+		}
+	case cfg.ZipPath == "-" && cfg.NameFrom != "family":
+		return errors.New("-name or -name-from=family must be given when reading the zip file from stdin")
+	}
+	if cfg.Stdout {
+		if cfg.ZipPath != "" || cfg.DirPath != "" {
+			return errors.New("-stdout can't be given with -zip or -dir (give the font file with -font)")
+		}
+		return printVariantPkg(&cfg)
+	} else if cfg.Font != "" {
+		return errors.New("-font can only be given with -stdout")
+	}
+	if cfg.NameFrom != "zip" && cfg.NameFrom != "family" {
+		return errors.New("-name-from must be either 'zip' or 'family'")
+	}
+	if cfg.Prefer != "" && cfg.Prefer != "otf" && cfg.Prefer != "ttf" {
+		return errors.New("-prefer must be either 'otf' or 'ttf'")
+	}
+	if cfg.Commit && cfg.NoGit {
+		return errors.New("-commit can't be given with -no-git")
+	} else if cfg.Commit && strings.TrimSpace(cfg.CommitMessage) == "" {
+		return errors.New("-commit-message can't be empty")
+	} else if !cfg.Commit && (cfg.GitAuthor != "" || cfg.GitEmail != "") {
+		return errors.New("-git-author and -git-email can only be given with -commit")
+	}
+	if cfg.BuildCheck && cfg.NoMod {
+		return errors.New("-build-check can't be given with -no-mod, since the package needs a go.mod to be built")
+	}
+	if cfg.BuildTags && (cfg.Flat || cfg.EmbedFS) {
+		return errors.New("-build-tags can't be given with -flat or -embed-fs, since their font files are embedded all together")
+	}
+	if cfg.Flat && cfg.EmbedFS {
+		return errors.New("only one of -flat or -embed-fs may be given")
+	}
+	weights, err := parseWeights(cfg.Weights)
+	if err != nil {
+		return fmt.Errorf("invalid -weights: %w", err)
+	}
+	if cfg.MinWeight > 0 && cfg.MaxWeight > 0 && cfg.MinWeight > cfg.MaxWeight {
+		return fmt.Errorf("-min-weight %d is above -max-weight %d", cfg.MinWeight, cfg.MaxWeight)
+	}
+	var overrides map[string]variantOverride
+	if cfg.Overrides != "" {
+		if overrides, err = loadOverrides(cfg.Overrides); err != nil {
+			return fmt.Errorf("invalid -overrides: %w", err)
+		}
+	}
+	var ranges string
+	if cfg.Subset != "" {
+		if ranges, err = subsetRanges(cfg.Subset); err != nil {
+			return fmt.Errorf("invalid -subset: %w", err)
+		}
+		if _, err := exec.LookPath(subsetCommand); err != nil && !cfg.DryRun {
+			return fmt.Errorf("-subset needs the '%s' command from fontTools, which can be installed with 'pip install fonttools'", subsetCommand)
+		}
+	}
+	// The go and git commands are only run once everything else has been written, so
+	// finding out only then that they're missing would waste the whole run.
+	if !cfg.DryRun {
+		if _, err := exec.LookPath("go"); err != nil && !cfg.NoMod {
+			return errors.New("the go toolchain wasn't found on PATH (give -no-mod to skip the go commands)")
+		}
+		if _, err := exec.LookPath("git"); err != nil && !cfg.NoGit {
+			return errors.New("git wasn't found on PATH (give -no-git to skip the git commands)")
+		}
+	}
+	if cfg.SHA256 != "" && cfg.ZipPath == "" {
+		return errors.New("-sha256 can only be given with -zip")
+	} else if cfg.SHA256 != "" && !isSHA256(cfg.SHA256) {
+		return fmt.Errorf("-sha256 '%s' isn't a hex SHA-256 hash", cfg.SHA256)
+	}
+	includes, excludes := splitPatterns(cfg.Include), splitPatterns(cfg.Exclude)
+	extras := splitPatterns(cfg.CopyExtra)
+	for _, patterns := range [][]string{includes, excludes, extras} {
+		for _, p := range patterns {
+			if err := checkPattern(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	var files []sourceFile
+	if cfg.DirPath != "" {
+		var err error
+		if files, err = dirSourceFiles(cfg.DirPath); err != nil {
+			return fmt.Errorf("reading font dir: %w", err)
+		}
+	} else {
+		// The expected hash can also be kept next to the archive that was downloaded.
+		wantSum := cfg.SHA256
+		if wantSum == "" && cfg.ZipPath != "-" {
+			var err error
+			if wantSum, err = sidecarSHA256(cfg.ZipPath); err != nil {
+				return err
+			} else if wantSum != "" {
+				logInfo("verifying the archive's SHA-256 hash from '%s'", cfg.ZipPath+".sha256")
+			}
+		}
+
+		var closeArchive func()
+		var err error
+		if files, closeArchive, err = openArchive(cfg.ZipPath, wantSum); err != nil {
+			return fmt.Errorf("opening archive: %w", err)
+		}
+		defer closeArchive()
+	}
+
+	if cfg.Recurse {
+		var err error
+		if files, err = nestedZipFiles(files, 0); err != nil {
+			return fmt.Errorf("opening nested zip files: %w", err)
+		}
+	} else {
+		for _, f := range files {
+			if strings.EqualFold(path.Ext(f.Path()), ".zip") && !isMacOSMetadata(f.Path()) {
+				warnf("skipping nested zip file '%s' (give -recurse to read the fonts in it)", f.Path())
+			}
+		}
+	}
+	files = selectFiles(files, includes, excludes)
+	// The order of the entries of an archive depends on how it was made, while every
+	// choice made by the order of the files (like which of two identical fonts is kept)
+	// should only depend on what's in it.
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Path() < files[j].Path()
+	})
+
+	if cfg.ZipList {
+		for _, f := range files {
+			if !inZipDir(cfg.ZipDir, f.Path()) {
+				continue
+			}
+			fmt.Println(f.Path())
+		}
+		return nil
+	}
+	if cfg.List {
+		listFiles(&cfg, files)
+		return nil
+	}
+
+	// The package name is derived from the zip file's name, or from the directory's name
+	// when the fonts aren't zipped up, unless it's given explicitly.
+	srcName := archiveStem(filepath.Base(cfg.ZipPath))
+	if cfg.DirPath != "" {
+		srcName = filepath.Base(filepath.Clean(cfg.DirPath))
+	}
+	pkgName := sanitizePkgName(srcName)
+	switch {
+	case cfg.Name != "":
+		pkgName = cfg.Name
+	case cfg.NameFrom == "family":
+		family, err := familyName(files, cfg.ZipDir)
+		if err != nil {
+			return fmt.Errorf("reading font family name: %w", err)
+		}
+		pkgName = sanitizePkgName(family)
+	}
+
+	fnt := fontPkgInfo{
+		PkgName: pkgName,
+		ModPath: strings.TrimSuffix(cfg.ModPrefix, "/") + "/" + pkgName,
+		DirName: cfg.DirPrefix + pkgName,
+
+		LicenseRef:  cfg.LicenseRef,
+		LicenseURL:  cfg.LicenseURL,
+		Flat:        cfg.Flat,
+		EmbedFS:     cfg.EmbedFS,
+		BuildTags:   cfg.BuildTags,
+		ToolVersion: toolVersion(),
+		cfg:         &cfg,
+		weights:     weights,
+		ranges:      ranges,
+		overrides:   overrides,
+	}
+	if fnt.generated, fnt.fixedTime, err = sourceDateEpoch(); err != nil {
+		return err
+	}
+	if cfg.OutDir != "" {
+		fnt.DirName = filepath.Clean(cfg.OutDir)
+	}
+	// The go command ignores directories that start with an underscore, so the source
+	// files don't become part of the module's packages.
+	if cfg.KeepSrc {
+		fnt.SrcDir = "_src"
+	}
+	if _, ok := charsets[cfg.Subset]; ok {
+		fnt.Subset = cfg.Subset
+	} else if cfg.Subset != "" {
+		fnt.Subset = filepath.Base(cfg.Subset)
+	}
+
+	if cfg.Remote != "" && !cfg.NoGit {
+		var sb strings.Builder
+		tmpl, err := template.New("remote").Parse(cfg.Remote)
+		if err == nil {
+			err = tmpl.Execute(&sb, &fnt)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid -remote template: %w", err)
+		}
+		fnt.RemoteURL = sb.String()
+	}
+
+	logInfo("font name '%s'", fnt.PkgName)
+
+	if cfg.Force && cfg.FailOnExist {
+		return errors.New("only one of -force or -fail-on-exist may be given")
+	}
+
+	// The manifest of a previous run is what the changelog is made from, so it's read
+	// before -force clears the output directory.
+	prevManifest, readErr := readManifest(fnt.DirName)
+	if readErr != nil {
+		warnf("ignoring the previous manifest, so no changelog is written: %v", readErr)
+	}
+
+	// Make the parent output directory, and make sure it can actually be written to before
+	// any of the fonts are processed.
+	if entries, err := os.ReadDir(fnt.DirName); err == nil {
+		logInfo("target output directory '%s' already exists", fnt.DirName)
+		if err := prepareExistingDir(&cfg, fnt.DirName, entries); err != nil {
+			return err
+		}
+	} else if cfg.DryRun {
+		logDryRun("create directory '%s'", fnt.DirName)
+	} else {
+		fnt.track(fnt.DirName)
+		if err := os.MkdirAll(fnt.DirName, 0o755); err != nil {
+			return err
+		}
+	}
+
+	// Whatever this run created is removed again if it fails, so that it can just be run
+	// again rather than leaving a half-generated package behind.
+	var generated bool
+	defer func() {
+		if err != nil && !cfg.KeepPartial && !generated {
+			fnt.removeCreated()
+		}
+	}()
+	if !cfg.DryRun {
+		if err := checkWritable(fnt.DirName); err != nil {
+			return fmt.Errorf("output directory '%s' is not writable: %w", fnt.DirName, err)
+		}
+	}
+
+	var fontFiles []sourceFile
+	for _, f := range files {
+		if fnt.SrcDir != "" {
+			if err := copySrcFile(&fnt, f); err != nil {
+				return fmt.Errorf("copying source file: %w", err)
+			}
+		}
+		switch {
+		// The only text file of interest at this point would be a license file.
+		case isLicenseFile(f.Path(), cfg.LicenseFile):
+			if err := copyLicenseFile(&fnt, f); err != nil {
+				return fmt.Errorf("copying license file: %w", err)
+			}
+		// Create a sub-package for each font variant.
+		case isFontFile(f.Path()):
+			if !inZipDir(cfg.ZipDir, f.Path()) {
+				continue
+			}
+			fontFiles = append(fontFiles, f)
+		// Anything else is only copied if it's asked for, like a FONTLOG.txt.
+		case matchAny(extras, f.Path()):
+			if err := copyExtraFile(&fnt, f); err != nil {
+				return fmt.Errorf("copying extra file: %w", err)
+			}
+		default:
+			logInfo("skipping file '%s'", f.Path())
+		}
+	}
+
+	// A font usually can't be redistributed without its license, so it's the one thing
+	// that can't go missing without being noticed.
+	if fnt.LicenseFile == "" {
+		if cfg.RequireLicense {
+			return errors.New("no license file was found (and -require-license was given)")
+		}
+		warnf("NO LICENSE FILE WAS FOUND, so the generated package may not be legally redistributable; give one with -license if it has an unusual name")
+	}
+	if err := writeRootLicense(&fnt); err != nil {
+		return fmt.Errorf("writing root license file: %w", err)
+	}
+
+	if fnt.Header, err = makeHeader(&fnt); err != nil {
+		return fmt.Errorf("reading header file: %w", err)
+	}
+
+	if cfg.Prefer != "" {
+		fontFiles = preferFormat(fontFiles, cfg.Prefer)
+	}
+	if err := createVariantPkgs(&fnt, fontFiles, cfg.Jobs); err != nil {
+		return fmt.Errorf("creating font variant pkg: %w", err)
+	}
+
+	// The variants are listed from the thinnest to the boldest, with each italic after its
+	// upright counterpart, rather than alphabetically where "Black" would come first.
+	sort.SliceStable(fnt.Variants, func(i, j int) bool {
+		a, b := fnt.Variants[i], fnt.Variants[j]
+		if a.Weight != b.Weight {
+			return a.Weight < b.Weight
+		}
+		if a.Italic != b.Italic {
+			return !a.Italic
+		}
+		return a.PkgName < b.PkgName
+	})
+
+	assignFuncNames(fnt.Variants)
+	fnt.Version = familyVersion(fnt.Variants)
+
+	m := newManifest(&fnt)
+	if err := writeManifest(&fnt, &m); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	if prevManifest != nil {
+		if err := writeChangelog(&fnt, prevManifest, &m); err != nil {
+			return fmt.Errorf("writing changelog: %w", err)
+		}
+	}
+
+	outDir, err := filepath.Abs(fnt.DirName)
+	if err != nil {
+		return err
+	}
+
+	if err := writePkgRootFile(&fnt, outDir); err != nil {
+		return fmt.Errorf("writing pkg root file: %w", err)
+	}
+
+	if err := writeVariantFaceFiles(&fnt, outDir); err != nil {
+		return fmt.Errorf("writing variant face files: %w", err)
+	}
+
+	if err := writeDoc(&fnt, outDir); err != nil {
+		return fmt.Errorf("writing package doc: %w", err)
+	}
+
+	if err := writeFacesTest(&fnt, outDir); err != nil {
+		return fmt.Errorf("writing faces test: %w", err)
+	}
+
+	if err := writeExampleTest(&fnt, outDir); err != nil {
+		return fmt.Errorf("writing example test: %w", err)
+	}
+
+	if err := writeModFile(&fnt, outDir); err != nil {
+		return err
+	}
+
+	if err := checkBuild(&fnt, outDir); err != nil {
+		return err
+	}
+
+	if err := writeReadme(&fnt, outDir); err != nil {
+		return fmt.Errorf("writing readme: %w", err)
+	}
+
+	if err := writeGitignore(&fnt, outDir); err != nil {
+		return fmt.Errorf("writing .gitignore: %w", err)
+	}
+
+	if err := fixModTimes(&fnt, outDir); err != nil {
+		return fmt.Errorf("setting modification times: %w", err)
+	}
+
+	if err := initGitAndStageDiff(&fnt, outDir); err != nil {
+		return err
+	}
+
+	// Make sure there's a file in the website for this font's vanity module path.
+	if cfg.Website != "" {
+		websiteFile := filepath.Join(cfg.Website, "fonts", fnt.PkgName+".md")
+		if cfg.DryRun {
+			logDryRun("write '%s'", websiteFile)
+		} else {
+			fnt.track(websiteFile)
+			if err := os.WriteFile(websiteFile, []byte{}, 0o644); err != nil {
+				return fmt.Errorf("making vanity path entry in website: %w", err)
+			}
+		}
+	}
+
+	// The package is complete by now, so it's kept even if the hook fails (like when it
+	// pushes the package, and the remote can't be reached).
+	generated = true
+	if err := runPostHook(&fnt, outDir); err != nil {
+		return fmt.Errorf("'%s' was generated, but running -post-hook failed: %w", fnt.DirName, err)
+	}
+
+	if cfg.JSON {
+		return printResult(os.Stdout, &fnt, warnings.Warnings())
+	}
+	printSummary(&fnt)
+	return nil
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		fname, pkgName string
+		want           string
+	}{
+		{"Vegur-Bold.otf", "vegurbold", "Vegur-Bold.otf"},
+		{"My Font.ttf", "myfont", "My-Font.ttf"},
+		{"Vegur[wght].ttf", "vegurwght", "Vegur-wght.ttf"},
+		{"Vegur [wdth,wght].ttf", "vegurwdthwght", "Vegur-wdth-wght.ttf"},
+		{"it's.otf", "its", "it-s.otf"},
+		{"???.ttf", "font", "font.ttf"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeFileName(tt.fname, tt.pkgName); got != tt.want {
+			t.Errorf("sanitizeFileName(%q, %q) = %q, want %q", tt.fname, tt.pkgName, got, tt.want)
+		}
+	}
+}
+
+// TestEmbedRenamedFile checks that the //go:embed directive of a variant package matches
+// the name that its font file is written under, since a directive that doesn't would
+// only be found out by building the package.
+func TestEmbedRenamedFile(t *testing.T) {
+	if err := loadTemplates(""); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		fname string
+		want  string
+	}{
+		{"My Font.ttf", "My-Font.ttf"},
+		{"Vegur[wght].ttf", "Vegur-wght.ttf"},
+		{"???.ttf", "font.ttf"},
+	}
+	for _, tt := range tests {
+		v, err := newVariantPkgInfo(tt.fname, goregular.TTF)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.FontFileName != tt.want {
+			t.Errorf("font file name of '%s' is %q, want %q", tt.fname, v.FontFileName, tt.want)
+		}
+
+		data := struct {
+			*variantPkgInfo
+			Header string
+		}{&v, ""}
+		src, err := executeGoTemplate(variantPkgCodeTmpl, &data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pattern string
+		for _, line := range strings.Split(string(src), "\n") {
+			if p, ok := strings.CutPrefix(line, "//go:embed "); ok {
+				pattern = p
+			}
+		}
+		// The go command takes the directive's argument as a glob pattern.
+		if ok, err := path.Match(pattern, v.FontFileName); err != nil || !ok {
+			t.Errorf("//go:embed %s of '%s' doesn't match its file '%s'", pattern, tt.fname, v.FontFileName)
+		}
+		if !bytes.Contains(src, []byte("//go:embed "+tt.want+"\n")) {
+			t.Errorf("data.go of '%s' doesn't embed '%s':\n%s", tt.fname, tt.want, src)
+		}
+	}
+}
+
+func TestIsFontFileUppercase(t *testing.T) {
+	tests := []struct {
+		fname string
+		want  bool
+	}{
+		{"VEGUR.TTF", true},
+		{"fonts/Font.OTF", true},
+		{"x.WOFF2", true},
+		{"Vegur.Woff", true},
+		{"README.TXT", false},
+		{"OFL.TXT", false},
+	}
+	for _, tt := range tests {
+		if got := isFontFile(tt.fname); got != tt.want {
+			t.Errorf("isFontFile(%q) = %v, want %v", tt.fname, got, tt.want)
+		}
+	}
+}
+
+func TestLoadFontFileUppercase(t *testing.T) {
+	fonts, err := loadFontFile(memSourceFile{path: "fonts/VEGUR.TTF", data: goregular.TTF})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fonts) != 1 {
+		t.Fatalf("got %d fonts, want 1", len(fonts))
+	}
+	v := fonts[0].variant
+	if v.FontFileName != "VEGUR.ttf" || v.DataVarName != "TTF" || v.PkgName != "vegur" {
+		t.Errorf("got file name %q, data variable %q and package %q, want \"VEGUR.ttf\", \"TTF\" and \"vegur\"",
+			v.FontFileName, v.DataVarName, v.PkgName)
+	}
+}
+
+func TestVersionNumber(t *testing.T) {
+	tests := []struct{ version, want string }{
+		{"Version 2.010", "2.010"},
+		{"Version 2.010; ttfautohint (v1.8)", "2.010"},
+		{"version 1.1;hotconv 1.0.109", "1.1"},
+		{"2.37", "2.37"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		fnt := fontPkgInfo{Version: tt.version}
+		if got := fnt.VersionNumber(); got != tt.want {
+			t.Errorf("VersionNumber of %q = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
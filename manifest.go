@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+)
+
+// manifestFileName is the name of the file in the root of the generated package that
+// records where its fonts came from.
+const manifestFileName = "mkfontpkg.json"
+
+// manifest is the provenance info about a generated font package, so that it can be
+// audited and regenerated from the same source later on. It also records enough about
+// the package to regenerate its README without the source.
+type manifest struct {
+	Source       string            `json:"source"` // The zip file or directory name (ex: "Vegur.zip"), or "(stdin)"
+	Generated    time.Time         `json:"generated"`
+	ToolVersion  string            `json:"toolVersion"`
+	Module       string            `json:"module"`
+	Package      string            `json:"package"`
+	Layout       string            `json:"layout,omitempty"`  // "flat" or "embed-fs" with those flags
+	Version      string            `json:"version,omitempty"` // The font's version (ex: "Version 2.010")
+	License      string            `json:"license,omitempty"` // The SPDX ID, if recognized
+	LicenseFile  string            `json:"licenseFile,omitempty"`
+	LicenseRef   string            `json:"licenseRef,omitempty"`
+	LicenseURL   string            `json:"licenseURL,omitempty"`
+	LicenseFiles []string          `json:"licenseFiles,omitempty"`
+	ExtraFiles   []string          `json:"extraFiles,omitempty"`
+	SrcDir       string            `json:"srcDir,omitempty"`
+	TotalSize    int               `json:"totalSize"`        // The size in bytes of all of the font files
+	Subset       string            `json:"subset,omitempty"` // The -subset character set or file name, if any
+	Variants     []manifestVariant `json:"variants"`
+}
+
+type manifestVariant struct {
+	PkgName        string   `json:"pkgName"`
+	FuncName       string   `json:"funcName"`
+	FontFile       string   `json:"fontFile"`
+	PostScriptName string   `json:"postScriptName,omitempty"`
+	Family         string   `json:"family,omitempty"`
+	Version        string   `json:"version,omitempty"`
+	Weight         int      `json:"weight"`
+	Italic         bool     `json:"italic,omitempty"`
+	Monospace      bool     `json:"monospace,omitempty"`
+	SourcePath     string   `json:"sourcePath"`
+	SHA256         string   `json:"sha256"`
+	Size           int      `json:"size,omitempty"`     // The size in bytes of the font file, if it has one of its own
+	Instance       string   `json:"instance,omitempty"` // The named instance of the variable font, if it's one
+	HasInstances   bool     `json:"hasInstances,omitempty"`
+	Blocks         []string `json:"blocks,omitempty"` // The Unicode blocks that the font covers
+}
+
+// version is the version of this tool, which can be set when building it with
+// -ldflags "-X main.version=v1.2.3" to override the one from its build info.
+var version string
+
+// toolVersion returns the version of this tool as it was built, which is "(devel)" for
+// builds from a local checkout unless the version variable is set.
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "unknown"
+}
+
+// newManifest returns the manifest of the font package as it's being generated.
+func newManifest(fnt *fontPkgInfo) manifest {
+	source := filepath.Base(fnt.cfg.ZipPath)
+	if fnt.cfg.ZipPath == "-" {
+		source = "(stdin)"
+	} else if fnt.cfg.DirPath != "" {
+		source = filepath.Base(filepath.Clean(fnt.cfg.DirPath))
+	}
+	m := manifest{
+		Source:       source,
+		Generated:    fnt.generated,
+		ToolVersion:  fnt.ToolVersion,
+		Module:       fnt.ModPath,
+		Package:      fnt.PkgName,
+		Version:      fnt.Version,
+		License:      fnt.License,
+		LicenseFile:  fnt.LicenseFile,
+		LicenseRef:   fnt.LicenseRef,
+		LicenseURL:   fnt.LicenseURL,
+		LicenseFiles: fnt.LicenseFiles,
+		ExtraFiles:   fnt.ExtraFiles,
+		SrcDir:       fnt.SrcDir,
+		TotalSize:    fnt.TotalFileSize(),
+		Subset:       fnt.Subset,
+		Variants:     make([]manifestVariant, len(fnt.Variants)),
+	}
+	if fnt.Flat {
+		m.Layout = "flat"
+	} else if fnt.EmbedFS {
+		m.Layout = "embed-fs"
+	}
+	for i, v := range fnt.Variants {
+		m.Variants[i] = manifestVariant{
+			PkgName:        v.PkgName,
+			FuncName:       v.FuncName,
+			FontFile:       v.FontFileName,
+			PostScriptName: v.PostScriptName,
+			Family:         v.Family,
+			Version:        v.Version,
+			Weight:         v.Weight,
+			Italic:         v.Italic,
+			Monospace:      v.Monospace,
+			SourcePath:     v.SourcePath,
+			SHA256:         v.SHA256,
+			Size:           v.FileSize,
+			Instance:       v.Instance,
+			HasInstances:   v.HasInstances,
+			Blocks:         v.Blocks,
+		}
+	}
+	return m
+}
+
+// fontPkgInfo returns the info about the font package in the given directory that the
+// manifest was written for, as far as it's needed to regenerate the package's README.
+func (m *manifest) fontPkgInfo(cfg *config, dir string) (*fontPkgInfo, error) {
+	if m.Module == "" || m.Package == "" {
+		return nil, errors.New("the manifest was written by an older version of mkfontpkg that didn't record enough about the package, so it has to be regenerated from its source")
+	}
+	fnt := &fontPkgInfo{
+		PkgName:      m.Package,
+		DirName:      dir,
+		ModPath:      m.Module,
+		LicenseFile:  m.LicenseFile,
+		License:      m.License,
+		LicenseFiles: m.LicenseFiles,
+		LicenseRef:   m.LicenseRef,
+		LicenseURL:   m.LicenseURL,
+		ExtraFiles:   m.ExtraFiles,
+		Flat:         m.Layout == "flat",
+		EmbedFS:      m.Layout == "embed-fs",
+		SrcDir:       m.SrcDir,
+		ToolVersion:  m.ToolVersion,
+		Version:      m.Version,
+		Subset:       m.Subset,
+		cfg:          cfg,
+	}
+	for _, v := range m.Variants {
+		fnt.Variants = append(fnt.Variants, variantPkgInfo{
+			FontFileName:   v.FontFile,
+			PkgName:        v.PkgName,
+			FuncName:       v.FuncName,
+			Weight:         v.Weight,
+			Italic:         v.Italic,
+			Monospace:      v.Monospace,
+			PostScriptName: v.PostScriptName,
+			Family:         v.Family,
+			Version:        v.Version,
+			SourcePath:     v.SourcePath,
+			SHA256:         v.SHA256,
+			FileSize:       v.Size,
+			Instance:       v.Instance,
+			HasInstances:   v.HasInstances,
+			Blocks:         v.Blocks,
+		})
+	}
+	return fnt, nil
+}
+
+// readManifest returns the manifest in the given output directory from a previous run, or
+// nil if there isn't one.
+func readManifest(dir string) (*manifest, error) {
+	b, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// writeManifest writes the given manifest of the font into the root of its output
+// directory.
+func writeManifest(fnt *fontPkgInfo, m *manifest) error {
+	manifestPath := filepath.Join(fnt.DirName, manifestFileName)
+	if fnt.cfg.DryRun {
+		logDryRun("write '%s'", manifestPath)
+		return nil
+	}
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	fnt.track(manifestPath)
+	return os.WriteFile(manifestPath, append(b, '\n'), 0o644)
+}
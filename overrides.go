@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// variantOverride is what the -overrides file gives for the fonts of one source file, in
+// place of what's detected from their tables and file name. Each of its fields is only
+// overridden if it's set in the file.
+type variantOverride struct {
+	Weight *int    `json:"weight"` // The OS/2 weight class (ex: 700)
+	Style  *string `json:"style"`  // "regular" or "italic" (or "oblique")
+	Italic *bool   `json:"italic"` // The same as "style", as a boolean
+	Name   string  `json:"name"`   // The exported name of its function in the root package (ex: "Heavy")
+}
+
+// loadOverrides returns the overrides in the -overrides file at the given path, which is
+// a JSON object keyed by the path of each source file within the source, or just its
+// file name (ex: {"Vegur-Bold.otf": {"weight": 800, "name": "Heavy"}}).
+func loadOverrides(p string) (map[string]variantOverride, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	// Misspelled fields would otherwise be silently ignored, which is what the file is
+	// there to keep from happening to the font's metadata.
+	var overrides map[string]variantOverride
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&overrides); err != nil {
+		return nil, fmt.Errorf("parsing '%s': %w", p, err)
+	}
+
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	names := make(map[string]string)
+	for _, key := range keys {
+		o := overrides[key]
+		if o.Weight != nil && (*o.Weight < 1 || *o.Weight > 1000) {
+			return nil, fmt.Errorf("the weight of '%s' must be between 1 and 1000", key)
+		}
+		if o.Style != nil {
+			italic, err := parseStyle(*o.Style)
+			if err != nil {
+				return nil, fmt.Errorf("the style of '%s': %w", key, err)
+			}
+			if o.Italic != nil && *o.Italic != italic {
+				return nil, fmt.Errorf("the style and italic of '%s' disagree", key)
+			}
+			o.Italic = &italic
+			overrides[key] = o
+		}
+		if o.Name == "" {
+			continue
+		}
+		if !token.IsIdentifier(o.Name) || !token.IsExported(o.Name) || o.Name == "Collection" || o.Name == "Face" {
+			return nil, fmt.Errorf("the name of '%s' must be an exported Go identifier other than 'Collection' or 'Face', not '%s'", key, o.Name)
+		}
+		if prev, ok := names[o.Name]; ok {
+			return nil, fmt.Errorf("'%s' and '%s' both have the name '%s'", prev, key, o.Name)
+		}
+		names[o.Name] = key
+	}
+	return overrides, nil
+}
+
+// parseStyle reports whether the given style of an override is italic.
+func parseStyle(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "regular", "normal":
+		return false, nil
+	case "italic", "oblique":
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown style '%s' (must be 'regular' or 'italic')", s)
+}
+
+// applyOverride applies the override for the source file of the given fonts, which were
+// all loaded from the same file, if there is one, and records that it was used.
+func applyOverride(fnt *fontPkgInfo, fonts []fontFile, used map[string]bool) error {
+	if len(fonts) == 0 {
+		return nil
+	}
+	src := fonts[0].variant.SourcePath
+	key := src
+	o, ok := fnt.overrides[key]
+	if !ok {
+		key = path.Base(src)
+		if o, ok = fnt.overrides[key]; !ok {
+			return nil
+		}
+	}
+	// A file name could match files in several directories of the source, which can't
+	// all have the same function.
+	if o.Name != "" && (len(fonts) > 1 || used[key]) {
+		return fmt.Errorf("the override for '%s' in '%s' gives a name, but it matches more than one font", key, fnt.cfg.Overrides)
+	}
+	used[key] = true
+
+	for i := range fonts {
+		v := &fonts[i].variant
+		if o.Weight != nil && *o.Weight != v.Weight {
+			logInfo("overriding the weight of '%s' from %d to %d", src, v.Weight, *o.Weight)
+			v.Weight = *o.Weight
+		}
+		if o.Italic != nil && *o.Italic != v.Italic {
+			from := v.Style()
+			v.Italic = *o.Italic
+			logInfo("overriding the style of '%s' from %s to %s", src, from, v.Style())
+		}
+		v.FuncName = o.Name
+	}
+	return nil
+}
+
+// warnUnusedOverrides warns about the overrides that didn't match any of the source files,
+// which are most likely misspelled.
+func warnUnusedOverrides(fnt *fontPkgInfo, used map[string]bool) {
+	var unused []string
+	for key := range fnt.overrides {
+		if !used[key] {
+			unused = append(unused, key)
+		}
+	}
+	sort.Strings(unused)
+	for _, key := range unused {
+		warnf("the override for '%s' in '%s' didn't match any of the font files", key, fnt.cfg.Overrides)
+	}
+}
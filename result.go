@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// runResult is what's printed about a run with -json, for tools that wrap this one. Unlike
+// the manifest, which is kept with the package, it's only about what this run generated.
+type runResult struct {
+	Package     string            `json:"package"`
+	Module      string            `json:"module"`
+	Dir         string            `json:"dir"`
+	DryRun      bool              `json:"dryRun,omitempty"`
+	License     string            `json:"license,omitempty"` // The SPDX ID, if recognized
+	LicenseFile string            `json:"licenseFile,omitempty"`
+	TotalSize   int               `json:"totalSize"` // The size in bytes of all of the font files
+	Variants    []manifestVariant `json:"variants"`
+	Warnings    []string          `json:"warnings"`
+}
+
+// printResult writes the result of the run that generated the given font package to w as
+// a single line of JSON, so that the results of several archives are a line each.
+func printResult(w io.Writer, fnt *fontPkgInfo, warnings []string) error {
+	r := runResult{
+		Package:     fnt.PkgName,
+		Module:      fnt.ModPath,
+		Dir:         fnt.DirName,
+		DryRun:      fnt.cfg.DryRun,
+		License:     fnt.License,
+		LicenseFile: fnt.LicenseFile,
+		TotalSize:   fnt.TotalFileSize(),
+		Variants:    newManifest(fnt).Variants,
+		Warnings:    warnings,
+	}
+	if r.Warnings == nil {
+		r.Warnings = []string{}
+	}
+	return json.NewEncoder(w).Encode(r)
+}
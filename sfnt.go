@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"unicode/utf16"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// sfntTable is a single named table of an sfnt (OTF or TTF) font file.
+type sfntTable struct {
+	tag  string
+	data []byte
+}
+
+// sfntExt returns the file extension (without the dot) that matches the flavor of the
+// given sfnt font data: "otf" for CFF-based fonts and "ttf" for everything else.
+func sfntExt(b []byte) string {
+	if len(b) >= 4 && string(b[:4]) == "OTTO" {
+		return "otf"
+	}
+	return "ttf"
+}
+
+// sfntChecksum returns the OpenType table checksum of b, which is the sum of its
+// big-endian uint32 words with any trailing bytes zero-padded.
+func sfntChecksum(b []byte) uint32 {
+	var sum uint32
+	for len(b) >= 4 {
+		sum += binary.BigEndian.Uint32(b)
+		b = b[4:]
+	}
+	if len(b) > 0 {
+		var last [4]byte
+		copy(last[:], b)
+		sum += binary.BigEndian.Uint32(last[:])
+	}
+	return sum
+}
+
+// buildSFNT assembles the given tables into a single sfnt font file with the given
+// flavor (sfnt version), sorting the table directory and filling in the checksums as
+// the OpenType spec requires.
+func buildSFNT(flavor uint32, tables []sfntTable) []byte {
+	sort.Slice(tables, func(i, j int) bool { return tables[i].tag < tables[j].tag })
+
+	numTables := len(tables)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= numTables {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	size := 12 + 16*numTables
+	for _, t := range tables {
+		size += (len(t.data) + 3) &^ 3
+	}
+	out := make([]byte, size)
+
+	binary.BigEndian.PutUint32(out[0:], flavor)
+	binary.BigEndian.PutUint16(out[4:], uint16(numTables))
+	binary.BigEndian.PutUint16(out[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(out[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(out[10:], uint16(numTables*16-searchRange))
+
+	headOffset := -1
+	offset := 12 + 16*numTables
+	for i, t := range tables {
+		data := out[offset : offset+len(t.data)]
+		copy(data, t.data)
+		if t.tag == "head" && len(data) >= 12 {
+			// The checksum adjustment is computed over the whole file below, and must
+			// be zero while calculating the head table's own checksum.
+			binary.BigEndian.PutUint32(data[8:], 0)
+			headOffset = offset
+		}
+
+		entry := out[12+16*i:]
+		copy(entry[0:4], t.tag)
+		binary.BigEndian.PutUint32(entry[4:], sfntChecksum(data))
+		binary.BigEndian.PutUint32(entry[8:], uint32(offset))
+		binary.BigEndian.PutUint32(entry[12:], uint32(len(t.data)))
+		offset += (len(t.data) + 3) &^ 3
+	}
+
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(out[headOffset+8:], 0xB1B0AFBA-sfntChecksum(out))
+	}
+	return out
+}
+
+// sfntTables returns the raw tables of the given sfnt font data keyed by their tags.
+func sfntTables(b []byte) (map[string][]byte, error) {
+	_, tables, err := readTableDir(b, 0)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string][]byte, len(tables))
+	for _, t := range tables {
+		m[t.tag] = t.data
+	}
+	return m, nil
+}
+
+// readTableDir reads the sfnt table directory at the given offset of b, which is zero for
+// a single font but may be elsewhere within a font collection, and returns the font's
+// flavor (sfnt version) and tables.
+func readTableDir(b []byte, offset int) (uint32, []sfntTable, error) {
+	r := &fontReader{b: b, off: offset}
+	flavor := r.u32()
+	numTables := int(r.u16())
+	r.bytes(6) // searchRange, entrySelector, rangeShift
+	if r.err != nil {
+		return 0, nil, r.err
+	}
+
+	tables := make([]sfntTable, 0, numTables)
+	for i := 0; i < numTables; i++ {
+		tag := string(r.bytes(4))
+		r.u32() // checksum
+		offset, length := r.u32(), r.u32()
+		if r.err != nil {
+			return 0, nil, r.err
+		}
+		if uint64(offset)+uint64(length) > uint64(len(b)) {
+			return 0, nil, fmt.Errorf("table '%s': %w", tag, errTruncated)
+		}
+		tables = append(tables, sfntTable{tag: tag, data: b[offset : offset+length]})
+	}
+	return flavor, tables, nil
+}
+
+// isCollection reports whether the given font data is a TrueType or OpenType collection
+// (TTC or OTC) of multiple fonts rather than a single sfnt font.
+func isCollection(b []byte) bool {
+	return len(b) >= 4 && string(b[:4]) == "ttcf"
+}
+
+// splitCollection extracts each of the fonts in the given TTC or OTC font collection into
+// its own standalone sfnt font. Tables that are shared between multiple fonts in the
+// collection are copied into each of them.
+func splitCollection(b []byte) ([][]byte, error) {
+	// The collection's header is validated by the sfnt package, which limits the number
+	// of fonts, so that a crafted count can't make the offsets take up gigabytes. The
+	// tables still have to be copied out by hand, since it doesn't give access to them.
+	if _, err := sfnt.ParseCollection(b); err != nil {
+		return nil, err
+	}
+	r := &fontReader{b: b}
+	if string(r.bytes(4)) != "ttcf" {
+		return nil, errors.New("missing font collection signature")
+	}
+	r.u32() // version
+	numFonts := int(r.u32())
+	if 12+4*uint64(numFonts) > uint64(len(b)) {
+		return nil, fmt.Errorf("%d font offsets: %w", numFonts, errTruncated)
+	}
+	offsets := make([]int, numFonts)
+	for i := range offsets {
+		offsets[i] = int(r.u32())
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	fonts := make([][]byte, numFonts)
+	for i, offset := range offsets {
+		flavor, tables, err := readTableDir(b, offset)
+		if err != nil {
+			return nil, fmt.Errorf("font %d: %w", i, err)
+		}
+		fonts[i] = buildSFNT(flavor, tables)
+	}
+	return fonts, nil
+}
+
+// sfntName returns the value of the given name ID from a name table, preferring US
+// English Windows entries, then Unicode entries, then Macintosh Roman entries. It returns
+// an empty string if the name table doesn't contain the name.
+func sfntName(name []byte, nameID uint16) string {
+	r := &fontReader{b: name}
+	r.u16() // format
+	count := int(r.u16())
+	storage := int(r.u16())
+
+	best, bestRank := "", 0
+	for i := 0; i < count && r.err == nil; i++ {
+		platformID, encodingID, languageID := r.u16(), r.u16(), r.u16()
+		id, length, offset := r.u16(), int(r.u16()), int(r.u16())
+		if r.err != nil || id != nameID || storage+offset+length > len(name) {
+			continue
+		}
+		value := name[storage+offset : storage+offset+length]
+
+		var rank int
+		switch {
+		case platformID == 3 && (encodingID == 1 || encodingID == 10) && languageID == 0x409:
+			rank = 4
+		case platformID == 3 && (encodingID == 1 || encodingID == 10):
+			rank = 3
+		case platformID == 0:
+			rank = 2
+		case platformID == 1 && encodingID == 0 && languageID == 0:
+			rank = 1
+		}
+		if rank <= bestRank {
+			continue
+		}
+
+		if platformID == 1 {
+			// This is fine for the ASCII subset of Mac Roman, which covers the English
+			// names of practically every font.
+			best = string(value)
+		} else {
+			u := make([]uint16, len(value)/2)
+			for j := range u {
+				u[j] = binary.BigEndian.Uint16(value[2*j:])
+			}
+			best = string(utf16.Decode(u))
+		}
+		bestRank = rank
+	}
+	return best
+}
+
+// fontMetadata is the descriptive info about a single font that's read from its sfnt
+// tables.
+type fontMetadata struct {
+	Family    string // The typographic family name (ex: "Vegur")
+	Subfamily string // The typographic subfamily name (ex: "Bold Italic")
+	Weight    int    // The OS/2 weight class (ex: 700)
+
+	PostScriptName string // The PostScript name (ex: "Vegur-Bold")
+	Version        string // The version string (ex: "Version 2.010")
+
+	// Italic is set if the font's OS/2 or head table style bits mark it as italic or
+	// oblique, and HasStyleBits reports whether any of those bits are set at all (including
+	// the OS/2 REGULAR and BOLD ones), since fonts that leave them all clear say nothing
+	// about their style.
+	Italic       bool
+	HasStyleBits bool
+
+	// Monospace is set if the post table's isFixedPitch field or the OS/2 table's PANOSE
+	// proportion marks the font as monospaced.
+	Monospace bool
+}
+
+// readFontMetadata reads the name and OS/2 tables of the given sfnt font data. Any of
+// the returned fields may be empty if the font is missing the corresponding tables.
+func readFontMetadata(b []byte) (fontMetadata, error) {
+	var md fontMetadata
+	tables, err := sfntTables(b)
+	if err != nil {
+		return md, err
+	}
+
+	if name := tables["name"]; name != nil {
+		// The typographic names (IDs 16 and 17) are preferred over the legacy ones (IDs
+		// 1 and 2), which are limited to four styles per family.
+		if md.Family = sfntName(name, 16); md.Family == "" {
+			md.Family = sfntName(name, 1)
+		}
+		if md.Subfamily = sfntName(name, 17); md.Subfamily == "" {
+			md.Subfamily = sfntName(name, 2)
+		}
+		md.PostScriptName = sfntName(name, 6)
+		md.Version = sfntName(name, 5)
+	}
+	if os2 := tables["OS/2"]; len(os2) >= 6 {
+		md.Weight = int(binary.BigEndian.Uint16(os2[4:]))
+	}
+
+	// The PANOSE proportion (its fourth byte) is only monospaced for Latin Text fonts
+	// (family kind 2), since it means something else for the other kinds.
+	if os2 := tables["OS/2"]; len(os2) >= 42 {
+		panose := os2[32:42]
+		md.Monospace = panose[0] == 2 && panose[3] == 9
+	}
+	if post := tables["post"]; len(post) >= 16 {
+		md.Monospace = md.Monospace || binary.BigEndian.Uint32(post[12:]) != 0
+	}
+
+	// The OS/2 fsSelection field has both an ITALIC (bit 0) and an OBLIQUE (bit 9) flag,
+	// while the head macStyle field only has an italic flag (bit 1).
+	if os2 := tables["OS/2"]; len(os2) >= 64 {
+		fsSelection := binary.BigEndian.Uint16(os2[62:])
+		md.Italic = fsSelection&(1<<0|1<<9) != 0
+		md.HasStyleBits = fsSelection&(1<<0|1<<5|1<<6|1<<9) != 0
+	}
+	if head := tables["head"]; len(head) >= 46 {
+		macStyle := binary.BigEndian.Uint16(head[44:])
+		md.Italic = md.Italic || macStyle&(1<<1) != 0
+		md.HasStyleBits = md.HasStyleBits || macStyle&(1<<0|1<<1) != 0
+	}
+	return md, nil
+}
+
+// axisValue is the value of a single variation axis of a variable font (ex: "wght" at 700).
+type axisValue struct {
+	Tag   string
+	Value float64
+}
+
+// fontInstance is one of the named instances of a variable font, which is a predefined
+// position in its design space.
+type fontInstance struct {
+	Subfamily string      // The instance's subfamily name (ex: "Condensed Black")
+	Coords    []axisValue // The instance's value for each of the font's axes
+}
+
+// weight returns the weight of the instance from its "wght" axis value, or the given
+// default weight if the font has no such axis.
+func (inst fontInstance) weight(def int) int {
+	for _, a := range inst.Coords {
+		if a.Tag == "wght" {
+			return int(math.Round(a.Value))
+		}
+	}
+	return def
+}
+
+// readFontInstances returns the named instances in the fvar table of the given sfnt
+// font data, which has none if it isn't a variable font.
+func readFontInstances(b []byte) ([]fontInstance, error) {
+	tables, err := sfntTables(b)
+	if err != nil {
+		return nil, err
+	}
+	fvar := tables["fvar"]
+	if fvar == nil {
+		return nil, nil
+	}
+
+	r := &fontReader{b: fvar}
+	r.u32() // majorVersion, minorVersion
+	axesOffset := int(r.u16())
+	r.u16() // reserved
+	axisCount, axisSize := int(r.u16()), int(r.u16())
+	instanceCount, instanceSize := int(r.u16()), int(r.u16())
+	if r.err != nil {
+		return nil, fmt.Errorf("reading fvar table: %w", r.err)
+	}
+	if axisSize < 20 || instanceSize < 4+4*axisCount {
+		return nil, errors.New("reading fvar table: invalid record sizes")
+	}
+
+	// Fixed is a signed 16.16 number.
+	fixed := func(u uint32) float64 { return float64(int32(u)) / (1 << 16) }
+
+	tags := make([]string, axisCount)
+	for i := range tags {
+		r := &fontReader{b: fvar, off: axesOffset + i*axisSize}
+		tags[i] = string(r.bytes(4))
+		if r.err != nil {
+			return nil, fmt.Errorf("reading fvar axis %d: %w", i, r.err)
+		}
+	}
+
+	instancesOffset := axesOffset + axisCount*axisSize
+	instances := make([]fontInstance, instanceCount)
+	for i := range instances {
+		r := &fontReader{b: fvar, off: instancesOffset + i*instanceSize}
+		nameID := r.u16()
+		r.u16() // flags
+		inst := fontInstance{Coords: make([]axisValue, axisCount)}
+		for j, tag := range tags {
+			inst.Coords[j] = axisValue{Tag: tag, Value: fixed(r.u32())}
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("reading fvar instance %d: %w", i, r.err)
+		}
+		if name := tables["name"]; name != nil {
+			inst.Subfamily = sfntName(name, nameID)
+		}
+		if inst.Subfamily == "" {
+			inst.Subfamily = fmt.Sprintf("Instance%d", i+1)
+		}
+		instances[i] = inst
+	}
+	return instances, nil
+}
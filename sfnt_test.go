@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// clearStyleBits returns a copy of the given font data with the style bits of its OS/2
+// fsSelection and head macStyle fields cleared.
+func clearStyleBits(t *testing.T, b []byte) []byte {
+	t.Helper()
+	b = append([]byte{}, b...)
+	tables, err := sfntTables(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os2, head := tables["OS/2"], tables["head"]
+	if len(os2) < 64 || len(head) < 46 {
+		t.Fatal("font is missing its OS/2 or head table")
+	}
+	os2[62], os2[63] = 0, 0
+	head[44], head[45] = 0, 0
+	return b
+}
+
+func TestReadFontMetadataStyleBits(t *testing.T) {
+	for _, b := range [][]byte{goregular.TTF, goitalic.TTF} {
+		md, err := readFontMetadata(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !md.HasStyleBits {
+			t.Errorf("'%s' has style bits, but HasStyleBits isn't set", md.PostScriptName)
+		}
+		md, err = readFontMetadata(clearStyleBits(t, b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md.HasStyleBits || md.Italic {
+			t.Errorf("'%s' without style bits has HasStyleBits %v and Italic %v, want neither", md.PostScriptName, md.HasStyleBits, md.Italic)
+		}
+	}
+}
+
+// TestStyleFallback checks that the style of a font without any style bits is taken from
+// its subfamily name instead.
+func TestStyleFallback(t *testing.T) {
+	v, err := newVariantPkgInfo("Go.ttf", clearStyleBits(t, goitalic.TTF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Italic {
+		t.Error("Go Italic without style bits isn't italic, going by its subfamily name")
+	}
+}
+
+func TestSplitCollectionCrafted(t *testing.T) {
+	for _, b := range []string{
+		"ttcf\x00\x01\x00\x00\x7f\xff\xff\xff",
+		"ttcf\x00\x01\x00\x00\x00\x00\x00\x02\x00\x00\x00\x10",
+		"ttcf\x00\x01\x00\x00",
+	} {
+		if _, err := splitCollection([]byte(b)); err == nil {
+			t.Errorf("splitCollection(%q) succeeded, want an error", b)
+		}
+	}
+}
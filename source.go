@@ -0,0 +1,416 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sourceFile is a single file from the font's source files, which are either the
+// entries of a zip file or the files within a directory tree on disk.
+type sourceFile interface {
+	// Path returns the slash-separated path of the file relative to the source root.
+	Path() string
+	Open() (io.ReadCloser, error)
+}
+
+type zipSourceFile struct {
+	*zip.File
+	name string // The cleaned up name of the entry
+}
+
+func (f zipSourceFile) Path() string { return f.name }
+
+type dirSourceFile struct {
+	root string
+	path string
+}
+
+func (f dirSourceFile) Path() string { return f.path }
+
+func (f dirSourceFile) Open() (io.ReadCloser, error) {
+	return os.Open(filepath.Join(f.root, filepath.FromSlash(f.path)))
+}
+
+// memSourceFile is a source file whose content was read into memory, like a font from
+// stdin with -stdout.
+type memSourceFile struct {
+	path string
+	data []byte
+}
+
+func (f memSourceFile) Path() string { return f.path }
+
+func (f memSourceFile) Open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+// readSourceFile returns the whole content of the given source file.
+func readSourceFile(f sourceFile) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// zipSourceFiles returns the regular files in the given zip file, leaving out the
+// entries for directories (ex: "fonts/"), which would otherwise be read as empty files.
+// Their paths start with the given prefix, which is for the files of nested zip files.
+func zipSourceFiles(z *zip.Reader, prefix string) []sourceFile {
+	files := make([]sourceFile, 0, len(z.File))
+	for _, f := range z.File {
+		if !f.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		name, ok := archivePath(f.Name)
+		if !ok {
+			continue
+		}
+		files = append(files, zipSourceFile{File: f, name: prefix + name})
+	}
+	return files
+}
+
+// maxNestingDepth is how many zip files deep the nested ones are opened with -recurse,
+// so that a crafted archive can't nest them endlessly.
+const maxNestingDepth = 4
+
+// nestedZipFiles returns the given files with each of the zip files among them replaced
+// by the files within it, for -recurse, which is how some font marketplaces wrap each
+// family. Their paths are prefixed with that of the zip file that they're in (ex:
+// "Vegur.zip/fonts/Vegur-Bold.otf"), and nested zip files are read into memory, since a
+// zip file needs random access.
+func nestedZipFiles(files []sourceFile, depth int) ([]sourceFile, error) {
+	var expanded []sourceFile
+	for _, f := range files {
+		if !strings.EqualFold(path.Ext(f.Path()), ".zip") || isMacOSMetadata(f.Path()) {
+			expanded = append(expanded, f)
+			continue
+		}
+		if depth >= maxNestingDepth {
+			warnf("skipping '%s' since it's nested more than %d zip files deep", f.Path(), maxNestingDepth)
+			continue
+		}
+		b, err := readSourceFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading '%s': %w", f.Path(), err)
+		}
+		z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			warnf("skipping '%s' since it can't be read as a zip file: %v", f.Path(), err)
+			continue
+		}
+		logInfo("reading the files in nested zip file '%s'", f.Path())
+		inner, err := nestedZipFiles(zipSourceFiles(z, f.Path()+"/"), depth+1)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, inner...)
+	}
+	return expanded, nil
+}
+
+// archivePath returns the cleaned up version of the given archive entry name, or false if
+// it leads outside of the archive (ex: "../../.bashrc") or is absolute (ex: "/etc/passwd"),
+// since the entry names of a crafted archive could otherwise be used to write files
+// anywhere.
+func archivePath(name string) (string, bool) {
+	p := path.Clean(name)
+	if strings.HasPrefix(name, "/") || !fs.ValidPath(p) {
+		warnf("skipping '%s' in archive since its path leads outside of it", name)
+		return "", false
+	}
+	return p, true
+}
+
+// dirSourceFiles returns all of the regular files in the directory tree rooted at root.
+func dirSourceFiles(root string) ([]sourceFile, error) {
+	var files []sourceFile
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, dirSourceFile{root: root, path: filepath.ToSlash(rel)})
+		return nil
+	})
+	return files, err
+}
+
+// archiveStem returns the file name of the given archive without its extensions, in
+// whichever case they are (ex: "Vegur.tar.gz" or "Vegur.TGZ" would return "Vegur").
+func archiveStem(name string) string {
+	for _, ext := range []string{".zip", ".tgz", ".gz", ".tar"} {
+		if len(name) >= len(ext) && strings.EqualFold(name[len(name)-len(ext):], ext) {
+			name = name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// openArchive returns the files in the zip or tar (optionally gzipped) archive at the
+// given path, or the one read from stdin if the path is "-", which is detected from its
+// content. The returned func releases its resources once the files are no longer needed.
+//
+// If wantSum is given, it's the hex SHA-256 hash that the archive must have. A file is
+// hashed before anything else is read from it, while stdin is hashed as it's read, since
+// it can only be read once.
+func openArchive(p, wantSum string) ([]sourceFile, func(), error) {
+	in := os.Stdin
+	if p != "-" {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		in = f
+	}
+
+	var r io.Reader = in
+	var stdinHash hash.Hash
+	if wantSum != "" && p != "-" {
+		h := sha256.New()
+		if _, err := io.Copy(h, in); err != nil {
+			in.Close()
+			return nil, nil, err
+		}
+		if err := checkSum(h, wantSum); err != nil {
+			in.Close()
+			return nil, nil, err
+		}
+		if _, err := in.Seek(0, io.SeekStart); err != nil {
+			in.Close()
+			return nil, nil, err
+		}
+	} else if wantSum != "" {
+		stdinHash = sha256.New()
+		r = io.TeeReader(in, stdinHash)
+	}
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(512)
+
+	isGzip := bytes.HasPrefix(head, []byte{0x1f, 0x8b})
+	isTar := len(head) >= 262 && string(head[257:262]) == "ustar"
+	if !isGzip && !isTar {
+		// A zip file needs random access, so all of stdin has to be buffered first.
+		var z *zip.Reader
+		var err error
+		if p == "-" {
+			var b []byte
+			if b, err = io.ReadAll(br); err == nil && stdinHash != nil {
+				err = checkSum(stdinHash, wantSum)
+			}
+			if err == nil {
+				z, err = zip.NewReader(bytes.NewReader(b), int64(len(b)))
+			}
+		} else {
+			var fi os.FileInfo
+			if fi, err = in.Stat(); err == nil {
+				z, err = zip.NewReader(in, fi.Size())
+			}
+		}
+		if err != nil {
+			in.Close()
+			return nil, nil, err
+		}
+		return zipSourceFiles(z, ""), func() { in.Close() }, nil
+	}
+
+	// A tar file can only be read sequentially, so its files are extracted to disk
+	// rather than holding them all in memory.
+	defer in.Close()
+	r = br
+	if isGzip {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	dir, err := os.MkdirTemp("", "mkfontpkg-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	files, err := tarSourceFiles(r, dir)
+	if err == nil && stdinHash != nil {
+		// Whatever follows the end of the archive is part of the hash too.
+		if _, err = io.Copy(io.Discard, br); err == nil {
+			err = checkSum(stdinHash, wantSum)
+		}
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return files, cleanup, nil
+}
+
+// checkSum returns an error if the hash isn't the given hex SHA-256 hash.
+func checkSum(h hash.Hash, wantSum string) error {
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != strings.ToLower(wantSum) {
+		return fmt.Errorf("the archive's SHA-256 hash is %s, but %s was expected", sum, wantSum)
+	}
+	return nil
+}
+
+// sidecarSHA256 returns the hex SHA-256 hash in the "<archive>.sha256" file next to the
+// given archive, in the format of sha256sum, or an empty string if there isn't one.
+func sidecarSHA256(p string) (string, error) {
+	b, err := os.ReadFile(p + ".sha256")
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 || !isSHA256(fields[0]) {
+		return "", fmt.Errorf("'%s' doesn't start with a SHA-256 hash", p+".sha256")
+	}
+	return fields[0], nil
+}
+
+// isSHA256 reports whether s is a hex SHA-256 hash.
+func isSHA256(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == sha256.Size
+}
+
+// tarSourceFiles extracts the regular files in the given tar stream into dir, and returns
+// them in the order that they're in within the archive.
+func tarSourceFiles(r io.Reader, dir string) ([]sourceFile, error) {
+	tr := tar.NewReader(r)
+	var files []sourceFile
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+
+		name, ok := archivePath(hdr.Name)
+		if !ok {
+			continue
+		}
+		diskPath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(diskPath), 0o755); err != nil {
+			return nil, err
+		}
+		if err := copyToDisk(tr, diskPath); err != nil {
+			return nil, fmt.Errorf("extracting '%s': %w", hdr.Name, err)
+		}
+		files = append(files, dirSourceFile{root: dir, path: name})
+	}
+}
+
+// splitPatterns returns the comma-separated glob patterns in s, ignoring any empty ones.
+func splitPatterns(s string) []string {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// checkPattern returns an error if the given glob pattern is malformed.
+func checkPattern(pattern string) error {
+	for _, seg := range strings.Split(pattern, "/") {
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchGlob reports whether the given slash-separated path matches the glob pattern,
+// which has the syntax of path.Match along with "**" segments that match any number of
+// directories (including none).
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matchAny reports whether the given slash-separated path matches any of the glob
+// patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if matchGlob(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMacOSMetadata reports whether the given slash-separated path is one of the files that
+// macOS adds to the archives it creates, which are either within a "__MACOSX" directory
+// or "._" AppleDouble files (ex: "__MACOSX/fonts/._Vegur.ttf"). These have the same
+// names as the files they belong to, extensions and all, but don't contain any font.
+func isMacOSMetadata(p string) bool {
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "__MACOSX" || strings.HasPrefix(seg, "._") {
+			return true
+		}
+	}
+	return false
+}
+
+// selectFiles returns the given files whose paths match at least one of the include
+// patterns (or all of them if there are none) and none of the exclude patterns, so
+// excludes win over includes. Any macOS metadata files are always left out.
+func selectFiles(files []sourceFile, include, exclude []string) []sourceFile {
+	var selected []sourceFile
+	for _, f := range files {
+		if isMacOSMetadata(f.Path()) {
+			logInfo("skipping macOS metadata file '%s'", f.Path())
+			continue
+		}
+		if (len(include) > 0 && !matchAny(include, f.Path())) || matchAny(exclude, f.Path()) {
+			continue
+		}
+		selected = append(selected, f)
+	}
+	return selected
+}
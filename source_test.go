@@ -0,0 +1,136 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// newTestZip returns a zip file with an entry for each of the given names, with the given
+// content, in order.
+func newTestZip(t *testing.T, entries map[string][]byte, names ...string) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(entries[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return z
+}
+
+func TestZipSourceFilesTraversal(t *testing.T) {
+	license := []byte("SIL OPEN FONT LICENSE Version 1.1\n")
+	names := []string{"../../etc/OFL.txt", "/abs/OFL.txt", "a/../../OFL.txt", "fonts/../OFL.txt"}
+	entries := make(map[string][]byte)
+	for _, name := range names {
+		entries[name] = license
+	}
+	files := zipSourceFiles(newTestZip(t, entries, names...), "")
+	if len(files) != 1 || files[0].Path() != "OFL.txt" {
+		var paths []string
+		for _, f := range files {
+			paths = append(paths, f.Path())
+		}
+		t.Fatalf("got files %q, want only \"OFL.txt\"", paths)
+	}
+
+	// Whatever is left is copied into the output directory, and only there.
+	root := t.TempDir()
+	outDir := filepath.Join(root, "out", "pkg")
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	fnt := &fontPkgInfo{DirName: outDir, cfg: &config{}}
+	for _, f := range files {
+		if err := copyLicenseFile(fnt, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if p != filepath.Join(outDir, "OFL.txt") {
+			t.Errorf("unexpected file '%s' was written", p)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchivePath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"fonts/Vegur.otf", "fonts/Vegur.otf", true},
+		{"./fonts//Vegur.otf", "fonts/Vegur.otf", true},
+		{"fonts/../Vegur.otf", "Vegur.otf", true},
+		{"../../etc/x", "", false},
+		{"/abs/x", "", false},
+		{"a/../../x", "", false},
+		{"..", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := archivePath(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("archivePath(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestZipSourceFilesDirEntries(t *testing.T) {
+	entries := map[string][]byte{"fonts/A.ttf": goregular.TTF}
+	files := zipSourceFiles(newTestZip(t, entries, "fonts/", "fonts/A.ttf", "empty/"), "")
+	if len(files) != 1 || files[0].Path() != "fonts/A.ttf" {
+		var paths []string
+		for _, f := range files {
+			paths = append(paths, f.Path())
+		}
+		t.Fatalf("got files %q, want only \"fonts/A.ttf\"", paths)
+	}
+	for _, f := range files {
+		if _, err := loadFontFile(f); err != nil {
+			t.Errorf("loading '%s': %v", f.Path(), err)
+		}
+	}
+}
+
+func TestArchiveStem(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"Vegur.zip", "Vegur"},
+		{"Fonts.ZIP", "Fonts"},
+		{"Family.TGZ", "Family"},
+		{"Vegur.tar.gz", "Vegur"},
+		{"Vegur.Tar.GZ", "Vegur"},
+		{"Vegur.tar", "Vegur"},
+		{"Vegur", "Vegur"},
+		{".zip", ""},
+	}
+	for _, tt := range tests {
+		if got := archiveStem(tt.name); got != tt.want {
+			t.Errorf("archiveStem(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import "strings"
+
+// gioWeights are the names of Gio's font.Weight constants indexed by the corresponding
+// OS/2 weight class divided by 100, minus one.
+var gioWeights = [9]string{
+	"Thin", "ExtraLight", "Light", "Normal", "Medium", "SemiBold", "Bold", "ExtraBold", "Black",
+}
+
+// gioWeight returns the name of the Gio font.Weight constant that's closest to the given
+// OS/2 weight class (ex: "Bold" for 700).
+func gioWeight(weight int) string {
+	// Some older fonts use the values 1 through 9 instead of 100 through 900.
+	if weight > 0 && weight < 10 {
+		weight *= 100
+	}
+	idx := (weight+50)/100 - 1
+	return gioWeights[max(0, min(idx, len(gioWeights)-1))]
+}
+
+// nameWeights maps the weight words that are commonly found in font file and style
+// names to their OS/2 weight classes. Longer words come first so that "semibold" isn't
+// mistaken for "bold", for example.
+var nameWeights = []struct {
+	word   string
+	weight int
+}{
+	{"extralight", 200},
+	{"ultralight", 200},
+	{"extrabold", 800},
+	{"ultrabold", 800},
+	{"semibold", 600},
+	{"demibold", 600},
+	{"hairline", 100},
+	{"medium", 500},
+	{"light", 300},
+	{"black", 900},
+	{"heavy", 900},
+	{"thin", 100},
+	{"bold", 700},
+}
+
+// weightFromName guesses the OS/2 weight class from the given file or style name,
+// defaulting to regular (400) if it doesn't contain any known weight words.
+func weightFromName(s string) int {
+	if w, ok := nameWeight(s); ok {
+		return w
+	}
+	return 400
+}
+
+// nameWeight returns the OS/2 weight class of the first known weight word in the given
+// file or style name, and whether it has one at all.
+func nameWeight(s string) (int, bool) {
+	s = strings.ToLower(strings.NewReplacer("-", "", "_", "", " ", "").Replace(s))
+	for _, w := range nameWeights {
+		if strings.Contains(s, w.word) {
+			return w.weight, true
+		}
+	}
+	return 0, false
+}
+
+// italicFromName guesses whether the given file or style name is of an italic font.
+func italicFromName(s string) bool {
+	s = strings.ToLower(s)
+	return strings.Contains(s, "italic") || strings.Contains(s, "oblique")
+}
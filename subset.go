@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// subsetCommand is the external command that fonts are subset with for -subset, which
+// comes with fontTools (https://github.com/fonttools/fonttools), since there's no font
+// subsetter for Go that handles all of the OpenType tables that Gio makes use of.
+const subsetCommand = "pyftsubset"
+
+// The named character sets for -subset are the same Unicode ranges as the subsets of the
+// same names on Google Fonts.
+const (
+	latinRanges    = "U+0000-00FF,U+0131,U+0152-0153,U+02BB-02BC,U+02C6,U+02DA,U+02DC,U+2000-206F,U+2074,U+20AC,U+2122,U+2191,U+2193,U+2212,U+2215,U+FEFF,U+FFFD"
+	latinExtRanges = "U+0100-024F,U+0259,U+1E00-1EFF,U+2020,U+20A0-20AB,U+20AD-20CF,U+2113,U+2C60-2C7F,U+A720-A7FF"
+)
+
+var charsets = map[string]string{
+	"latin":     latinRanges,
+	"latin-ext": latinRanges + "," + latinExtRanges,
+}
+
+// subsetRanges returns the Unicode ranges in the format of pyftsubset's --unicodes option
+// (ex: "U+0000-00FF,U+0131") for the given -subset value, which is either the name of one
+// of the charsets or the path of a file of codepoints.
+func subsetRanges(subset string) (string, error) {
+	if ranges, ok := charsets[subset]; ok {
+		return ranges, nil
+	}
+	b, err := os.ReadFile(subset)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("'%s' is neither 'latin', 'latin-ext' nor an existing file of codepoints", subset)
+	} else if err != nil {
+		return "", err
+	}
+	ranges, err := parseCodepoints(string(b))
+	if err != nil {
+		return "", fmt.Errorf("reading codepoints from '%s': %w", subset, err)
+	}
+	return ranges, nil
+}
+
+// parseCodepoints returns the codepoints in the given text in the same format as
+// subsetRanges. The text has hex codepoints or ranges of them (ex: "U+0041" or
+// "0020-007E"), separated by commas or whitespace, with comments from "#" to the end of
+// each line.
+func parseCodepoints(text string) (string, error) {
+	var ranges []string
+	for _, line := range strings.Split(text, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\r'
+		})
+		for _, f := range fields {
+			lo, hi, isRange := strings.Cut(f, "-")
+			first, err := parseCodepoint(lo)
+			if err != nil {
+				return "", err
+			}
+			last := first
+			if isRange {
+				if last, err = parseCodepoint(hi); err != nil {
+					return "", err
+				}
+				if last < first {
+					return "", fmt.Errorf("invalid codepoint range '%s'", f)
+				}
+			}
+			r := fmt.Sprintf("U+%04X", first)
+			if last != first {
+				r += fmt.Sprintf("-%04X", last)
+			}
+			ranges = append(ranges, r)
+		}
+	}
+	if len(ranges) == 0 {
+		return "", errors.New("no codepoints found")
+	}
+	return strings.Join(ranges, ","), nil
+}
+
+// parseCodepoint parses a single hex codepoint, with or without its "U+" prefix.
+func parseCodepoint(s string) (uint64, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "U+"), "u+")
+	n, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || n > 0x10FFFF {
+		return 0, fmt.Errorf("invalid codepoint '%s'", s)
+	}
+	return n, nil
+}
+
+// subsetFontFile replaces the font file at the given path with its subset to the given
+// Unicode ranges, keeping all of its layout features and names, and returns the new file's
+// data.
+func subsetFontFile(p, ranges string) ([]byte, error) {
+	subsetPath := p + ".subset"
+	err := runCommand(filepath.Dir(p), subsetCommand, filepath.Base(p), "--output-file="+filepath.Base(subsetPath),
+		"--unicodes="+ranges, "--layout-features=*", "--name-IDs=*", "--notdef-outline")
+	if err == nil {
+		err = os.Rename(subsetPath, p)
+	}
+	if err != nil {
+		os.Remove(subsetPath)
+		return nil, fmt.Errorf("running %s: %w", subsetCommand, err)
+	}
+	return os.ReadFile(p)
+}
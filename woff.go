@@ -0,0 +1,562 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+var errTruncated = errors.New("unexpected end of font data")
+
+// fontReader reads big-endian values from a byte slice. The first read past the end of
+// the data sets err, after which every read returns zero values.
+type fontReader struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (r *fontReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b)-r.off {
+		r.err = errTruncated
+		return nil
+	}
+	b := r.b[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *fontReader) u8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *fontReader) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *fontReader) u32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// base128 reads a WOFF2 UIntBase128 variable-length value.
+func (r *fontReader) base128() uint32 {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		b := r.u8()
+		if r.err != nil {
+			return 0
+		}
+		// Leading zeros and values that overflow 32 bits are invalid.
+		if (i == 0 && b == 0x80) || v&0xFE000000 != 0 {
+			r.err = errors.New("invalid UIntBase128 value")
+			return 0
+		}
+		v = v<<7 | uint32(b&0x7F)
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+	r.err = errors.New("invalid UIntBase128 value")
+	return 0
+}
+
+// u255 reads a WOFF2 255UInt16 variable-length value.
+func (r *fontReader) u255() uint16 {
+	switch code := r.u8(); code {
+	case 253:
+		return r.u16()
+	case 254:
+		return 253*2 + uint16(r.u8())
+	case 255:
+		return 253 + uint16(r.u8())
+	default:
+		return uint16(code)
+	}
+}
+
+// decodeWOFF unwraps a WOFF 1.0 font, which is just an sfnt whose tables may each be
+// compressed with zlib, and returns the plain sfnt font data.
+func decodeWOFF(b []byte) ([]byte, error) {
+	r := &fontReader{b: b}
+	if string(r.bytes(4)) != "wOFF" {
+		return nil, errors.New("missing WOFF signature")
+	}
+	flavor := r.u32()
+	r.u32() // length
+	numTables := int(r.u16())
+	// Skip the reserved field, the total sfnt size, the version, and the offsets to the
+	// metadata and private data blocks which have no place in the sfnt output.
+	r.bytes(2 + 4 + 4 + 20)
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	tables := make([]sfntTable, 0, numTables)
+	for i := 0; i < numTables; i++ {
+		tag := string(r.bytes(4))
+		offset, compLength, origLength := r.u32(), r.u32(), r.u32()
+		r.u32() // origChecksum
+		if r.err != nil {
+			return nil, r.err
+		}
+		if uint64(offset)+uint64(compLength) > uint64(len(b)) {
+			return nil, fmt.Errorf("table '%s': %w", tag, errTruncated)
+		}
+
+		data := b[offset : offset+compLength]
+		switch {
+		case compLength > origLength:
+			return nil, fmt.Errorf("table '%s': compressed length exceeds original length", tag)
+		case compLength < origLength:
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("table '%s': %w", tag, err)
+			}
+			data, err = io.ReadAll(io.LimitReader(zr, int64(origLength)))
+			if err != nil {
+				return nil, fmt.Errorf("table '%s': %w", tag, err)
+			}
+			if len(data) != int(origLength) {
+				return nil, fmt.Errorf("table '%s': decompressed length mismatch", tag)
+			}
+		}
+		tables = append(tables, sfntTable{tag: tag, data: data})
+	}
+	return buildSFNT(flavor, tables), nil
+}
+
+// woff2KnownTags are the table tags that WOFF2 encodes as a 6-bit index into this list
+// rather than spelling out all four bytes.
+var woff2KnownTags = [63]string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post", "cvt ", "fpgm",
+	"glyf", "loca", "prep", "CFF ", "VORG", "EBDT", "EBLC", "gasp", "hdmx", "kern",
+	"LTSH", "PCLT", "VDMX", "vhea", "vmtx", "BASE", "GDEF", "GPOS", "GSUB", "EBSC",
+	"JSTF", "MATH", "CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar",
+	"bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar", "gvar", "hsty",
+	"just", "lcar", "mort", "morx", "opbd", "prop", "trak", "Zapf", "Silf", "Glat",
+	"Gloc", "Feat", "Sill",
+}
+
+// decodeWOFF2 unwraps a WOFF 2.0 font and returns the plain sfnt font data. All of the
+// tables are stored in a single Brotli stream, and the glyf, loca, and hmtx tables may
+// additionally be transformed into a more compressible form which must be reversed.
+func decodeWOFF2(b []byte) ([]byte, error) {
+	r := &fontReader{b: b}
+	if string(r.bytes(4)) != "wOF2" {
+		return nil, errors.New("missing WOFF2 signature")
+	}
+	flavor := r.u32()
+	if flavor == 0x74746366 { // "ttcf"
+		return nil, errors.New("WOFF2 font collections are not supported")
+	}
+	r.u32() // length
+	numTables := int(r.u16())
+	r.u16() // reserved
+	totalSfntSize := int64(r.u32())
+	compressedSize := int(r.u32())
+	// Skip the version and the offsets to the metadata and private data blocks.
+	r.bytes(4 + 20)
+
+	type tableEntry struct {
+		tag         string
+		length      uint32
+		transformed bool
+	}
+	entries := make([]tableEntry, numTables)
+	for i := range entries {
+		flags := r.u8()
+		e := &entries[i]
+		if idx := flags & 0x3F; idx == 0x3F {
+			e.tag = string(r.bytes(4))
+		} else {
+			e.tag = woff2KnownTags[idx]
+		}
+		e.length = r.base128()
+		// The null transform is version 3 for glyf and loca but version 0 for all
+		// other tables, in which case the transformed length is omitted.
+		version := flags >> 6
+		if e.tag == "glyf" || e.tag == "loca" {
+			e.transformed = version == 0
+		} else {
+			e.transformed = version != 0
+		}
+		if e.transformed {
+			e.length = r.base128()
+		}
+	}
+	compressed := r.bytes(compressedSize)
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	// The decompressed tables can't be any larger than the font that they make up, which
+	// keeps a crafted brotli stream from expanding into all of the memory there is.
+	data, err := io.ReadAll(io.LimitReader(brotli.NewReader(bytes.NewReader(compressed)), totalSfntSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing font data: %w", err)
+	}
+	if int64(len(data)) > totalSfntSize {
+		return nil, fmt.Errorf("decompressed font data is larger than the font's size of %d bytes", totalSfntSize)
+	}
+
+	raw := make(map[string][]byte, numTables)
+	transformed := make(map[string]bool, numTables)
+	dr := &fontReader{b: data}
+	for _, e := range entries {
+		raw[e.tag] = dr.bytes(int(e.length))
+		transformed[e.tag] = e.transformed
+	}
+	if dr.err != nil {
+		return nil, fmt.Errorf("decompressed font data: %w", dr.err)
+	}
+
+	var xMins []int16
+	if transformed["glyf"] {
+		if !transformed["loca"] {
+			return nil, errors.New("transformed glyf table without a transformed loca table")
+		}
+		raw["glyf"], raw["loca"], xMins, err = reconstructGlyf(raw["glyf"])
+		if err != nil {
+			return nil, fmt.Errorf("reconstructing glyf table: %w", err)
+		}
+	} else if transformed["loca"] {
+		return nil, errors.New("transformed loca table without a transformed glyf table")
+	}
+
+	if transformed["hmtx"] {
+		if xMins == nil {
+			return nil, errors.New("transformed hmtx table without a transformed glyf table")
+		}
+		hhea := raw["hhea"]
+		if len(hhea) < 36 {
+			return nil, errors.New("hhea table is missing or truncated")
+		}
+		numHMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+		raw["hmtx"], err = reconstructHmtx(raw["hmtx"], numHMetrics, xMins)
+		if err != nil {
+			return nil, fmt.Errorf("reconstructing hmtx table: %w", err)
+		}
+	}
+
+	tables := make([]sfntTable, 0, numTables)
+	for _, e := range entries {
+		tables = append(tables, sfntTable{tag: e.tag, data: raw[e.tag]})
+	}
+	return buildSFNT(flavor, tables), nil
+}
+
+// woff2Point is a single decoded point of a simple glyph outline.
+type woff2Point struct {
+	x, y    int
+	onCurve bool
+}
+
+// reconstructGlyf reverses the WOFF2 glyf table transform, returning the original glyf
+// and loca tables along with each glyph's minimum x value for the hmtx transform.
+func reconstructGlyf(b []byte) (glyf, loca []byte, xMins []int16, err error) {
+	r := &fontReader{b: b}
+	r.u16() // reserved
+	optionFlags := r.u16()
+	numGlyphs := int(r.u16())
+	indexFormat := r.u16()
+	var streams [7]*fontReader
+	sizes := make([]int, len(streams))
+	for i := range sizes {
+		sizes[i] = int(r.u32())
+	}
+	for i := range streams {
+		streams[i] = &fontReader{b: r.bytes(sizes[i])}
+	}
+	nContourStream, nPointsStream, flagStream := streams[0], streams[1], streams[2]
+	glyphStream, compositeStream, bboxStream := streams[3], streams[4], streams[5]
+	instructionStream := streams[6]
+
+	var overlapBitmap []byte
+	if optionFlags&1 != 0 {
+		overlapBitmap = r.bytes((numGlyphs + 7) / 8)
+	}
+	bboxBitmap := bboxStream.bytes(4 * ((numGlyphs + 31) / 32))
+	if r.err != nil || bboxStream.err != nil {
+		return nil, nil, nil, errTruncated
+	}
+
+	offsets := make([]int, numGlyphs+1)
+	xMins = make([]int16, numGlyphs)
+	for i := 0; i < numGlyphs; i++ {
+		offsets[i] = len(glyf)
+		hasBBox := bboxBitmap[i>>3]&(0x80>>(i&7)) != 0
+		nContours := int16(nContourStream.u16())
+
+		switch {
+		case nContours == 0:
+			if hasBBox {
+				return nil, nil, nil, fmt.Errorf("glyph %d: empty glyph with a bounding box", i)
+			}
+
+		case nContours > 0:
+			endPts := make([]uint16, nContours)
+			numPoints := 0
+			for c := range endPts {
+				numPoints += int(nPointsStream.u255())
+				endPts[c] = uint16(numPoints - 1)
+			}
+			if nPointsStream.err != nil {
+				return nil, nil, nil, fmt.Errorf("glyph %d: %w", i, nPointsStream.err)
+			}
+			// Each point has a byte in the flag stream, so a crafted point count can't be
+			// any larger than what's left of it.
+			if numPoints > len(flagStream.b)-flagStream.off {
+				return nil, nil, nil, fmt.Errorf("glyph %d: %d points: %w", i, numPoints, errTruncated)
+			}
+			points := make([]woff2Point, numPoints)
+			var x, y int
+			for p := range points {
+				flag := flagStream.u8()
+				dx, dy := decodeTriplet(flag&0x7F, glyphStream)
+				x, y = x+dx, y+dy
+				points[p] = woff2Point{x: x, y: y, onCurve: flag&0x80 == 0}
+			}
+			instructions := instructionStream.bytes(int(glyphStream.u255()))
+
+			var bbox [4]int16
+			if hasBBox {
+				for j := range bbox {
+					bbox[j] = int16(bboxStream.u16())
+				}
+			} else if len(points) > 0 {
+				bbox = [4]int16{int16(points[0].x), int16(points[0].y), int16(points[0].x), int16(points[0].y)}
+				for _, pt := range points[1:] {
+					bbox[0] = min(bbox[0], int16(pt.x))
+					bbox[1] = min(bbox[1], int16(pt.y))
+					bbox[2] = max(bbox[2], int16(pt.x))
+					bbox[3] = max(bbox[3], int16(pt.y))
+				}
+			}
+			xMins[i] = bbox[0]
+
+			overlaps := overlapBitmap != nil && overlapBitmap[i>>3]&(0x80>>(i&7)) != 0
+			glyf = appendSimpleGlyph(glyf, nContours, bbox, endPts, instructions, points, overlaps)
+
+		case nContours == -1:
+			if !hasBBox {
+				return nil, nil, nil, fmt.Errorf("glyph %d: composite glyph without a bounding box", i)
+			}
+			var bbox [4]int16
+			for j := range bbox {
+				bbox[j] = int16(bboxStream.u16())
+			}
+			xMins[i] = bbox[0]
+
+			start := compositeStream.off
+			haveInstructions := false
+			for more := true; more && compositeStream.err == nil; {
+				flags := compositeStream.u16()
+				// The glyph index plus two byte-sized arguments.
+				n := 2 + 2
+				if flags&0x0001 != 0 { // ARG_1_AND_2_ARE_WORDS
+					n += 2
+				}
+				switch {
+				case flags&0x0008 != 0: // WE_HAVE_A_SCALE
+					n += 2
+				case flags&0x0040 != 0: // WE_HAVE_AN_X_AND_Y_SCALE
+					n += 4
+				case flags&0x0080 != 0: // WE_HAVE_A_TWO_BY_TWO
+					n += 8
+				}
+				compositeStream.bytes(n)
+				haveInstructions = haveInstructions || flags&0x0100 != 0
+				more = flags&0x0020 != 0 // MORE_COMPONENTS
+			}
+			if compositeStream.err != nil {
+				return nil, nil, nil, fmt.Errorf("glyph %d: %w", i, compositeStream.err)
+			}
+
+			glyf = binary.BigEndian.AppendUint16(glyf, uint16(nContours))
+			for _, v := range bbox {
+				glyf = binary.BigEndian.AppendUint16(glyf, uint16(v))
+			}
+			glyf = append(glyf, compositeStream.b[start:compositeStream.off]...)
+			if haveInstructions {
+				n := glyphStream.u255()
+				glyf = binary.BigEndian.AppendUint16(glyf, n)
+				glyf = append(glyf, instructionStream.bytes(int(n))...)
+			}
+
+		default:
+			return nil, nil, nil, fmt.Errorf("glyph %d: invalid number of contours %d", i, nContours)
+		}
+
+		for _, s := range streams {
+			if s.err != nil {
+				return nil, nil, nil, fmt.Errorf("glyph %d: %w", i, s.err)
+			}
+		}
+		for len(glyf)%4 != 0 {
+			glyf = append(glyf, 0)
+		}
+	}
+	offsets[numGlyphs] = len(glyf)
+
+	for _, off := range offsets {
+		if indexFormat == 0 {
+			if off/2 > 0xFFFF {
+				return nil, nil, nil, errors.New("glyf table too large for short loca offsets")
+			}
+			loca = binary.BigEndian.AppendUint16(loca, uint16(off/2))
+		} else {
+			loca = binary.BigEndian.AppendUint32(loca, uint32(off))
+		}
+	}
+	return glyf, loca, xMins, nil
+}
+
+// decodeTriplet decodes a single WOFF2 point coordinate delta whose encoding is selected
+// by flag, reading any extra bytes it needs from r.
+func decodeTriplet(flag uint8, r *fontReader) (dx, dy int) {
+	withSign := func(flag uint8, v int) int {
+		if flag&1 != 0 {
+			return v
+		}
+		return -v
+	}
+
+	f := int(flag)
+	switch {
+	case flag < 10:
+		dy = withSign(flag, (f&14)<<7+int(r.u8()))
+	case flag < 20:
+		dx = withSign(flag, ((f-10)&14)<<7+int(r.u8()))
+	case flag < 84:
+		b0, b1 := f-20, int(r.u8())
+		dx = withSign(flag, 1+(b0&0x30)+b1>>4)
+		dy = withSign(flag>>1, 1+(b0&0x0C)<<2+b1&0x0F)
+	case flag < 120:
+		b0, b1, b2 := f-84, int(r.u8()), int(r.u8())
+		dx = withSign(flag, 1+(b0/12)<<8+b1)
+		dy = withSign(flag>>1, 1+((b0%12)>>2)<<8+b2)
+	case flag < 124:
+		b1, b2, b3 := int(r.u8()), int(r.u8()), int(r.u8())
+		dx = withSign(flag, b1<<4+b2>>4)
+		dy = withSign(flag>>1, (b2&0x0F)<<8+b3)
+	default:
+		b1, b2, b3, b4 := int(r.u8()), int(r.u8()), int(r.u8()), int(r.u8())
+		dx = withSign(flag, b1<<8+b2)
+		dy = withSign(flag>>1, b3<<8+b4)
+	}
+	return dx, dy
+}
+
+// appendSimpleGlyph appends the standard glyf table encoding of a simple glyph to b.
+func appendSimpleGlyph(b []byte, nContours int16, bbox [4]int16, endPts []uint16, instructions []byte, points []woff2Point, overlaps bool) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(nContours))
+	for _, v := range bbox {
+		b = binary.BigEndian.AppendUint16(b, uint16(v))
+	}
+	for _, p := range endPts {
+		b = binary.BigEndian.AppendUint16(b, p)
+	}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(instructions)))
+	b = append(b, instructions...)
+
+	var xs, ys []byte
+	var prevX, prevY int
+	for i, pt := range points {
+		var flag uint8
+		if pt.onCurve {
+			flag |= 0x01
+		}
+		if i == 0 && overlaps {
+			flag |= 0x40 // OVERLAP_SIMPLE
+		}
+
+		switch dx := pt.x - prevX; {
+		case dx == 0:
+			flag |= 0x10 // X_IS_SAME_OR_POSITIVE_X_SHORT_VECTOR
+		case dx >= -255 && dx <= 255:
+			flag |= 0x02 // X_SHORT_VECTOR
+			if dx > 0 {
+				flag |= 0x10
+			} else {
+				dx = -dx
+			}
+			xs = append(xs, uint8(dx))
+		default:
+			xs = binary.BigEndian.AppendUint16(xs, uint16(int16(dx)))
+		}
+
+		switch dy := pt.y - prevY; {
+		case dy == 0:
+			flag |= 0x20 // Y_IS_SAME_OR_POSITIVE_Y_SHORT_VECTOR
+		case dy >= -255 && dy <= 255:
+			flag |= 0x04 // Y_SHORT_VECTOR
+			if dy > 0 {
+				flag |= 0x20
+			} else {
+				dy = -dy
+			}
+			ys = append(ys, uint8(dy))
+		default:
+			ys = binary.BigEndian.AppendUint16(ys, uint16(int16(dy)))
+		}
+
+		b = append(b, flag)
+		prevX, prevY = pt.x, pt.y
+	}
+	b = append(b, xs...)
+	return append(b, ys...)
+}
+
+// reconstructHmtx reverses the WOFF2 hmtx table transform, in which left side bearings
+// that equal the glyph's minimum x value may be omitted.
+func reconstructHmtx(b []byte, numHMetrics int, xMins []int16) ([]byte, error) {
+	numGlyphs := len(xMins)
+	if numHMetrics < 1 || numHMetrics > numGlyphs {
+		return nil, fmt.Errorf("invalid number of horizontal metrics %d", numHMetrics)
+	}
+
+	r := &fontReader{b: b}
+	flags := r.u8()
+	advances := make([]uint16, numHMetrics)
+	for i := range advances {
+		advances[i] = r.u16()
+	}
+	lsbs := make([]int16, numGlyphs)
+	for i := range lsbs {
+		proportional := i < numHMetrics
+		if (proportional && flags&1 != 0) || (!proportional && flags&2 != 0) {
+			lsbs[i] = xMins[i]
+		} else {
+			lsbs[i] = int16(r.u16())
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	out := make([]byte, 0, 4*numHMetrics+2*(numGlyphs-numHMetrics))
+	for i, lsb := range lsbs {
+		if i < numHMetrics {
+			out = binary.BigEndian.AppendUint16(out, advances[i])
+		}
+		out = binary.BigEndian.AppendUint16(out, uint16(lsb))
+	}
+	return out, nil
+}
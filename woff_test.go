@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// TestReconstructGlyfPointCount checks that a glyph whose contours claim more points than
+// there are flags for is rejected before the points are allocated.
+func TestReconstructGlyfPointCount(t *testing.T) {
+	streams := [7][]byte{
+		{0x7f, 0xff},             // nContour: 32767 contours
+		nil,                      // nPoints, filled in below
+		{0x01, 0x01, 0x01},       // flag: only three points' worth
+		nil,                      // glyph
+		nil,                      // composite
+		{0x00, 0x00, 0x00, 0x00}, // bbox: just the bitmap, with no bounding boxes
+		nil,                      // instruction
+	}
+	for i := 0; i < 32767; i++ {
+		streams[1] = append(streams[1], 253, 0xff, 0xff)
+	}
+
+	b := []byte{0, 0, 0, 0, 0, 1, 0, 0} // reserved, optionFlags, numGlyphs, indexFormat
+	for _, s := range streams {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	}
+	for _, s := range streams {
+		b = append(b, s...)
+	}
+	if _, _, _, err := reconstructGlyf(b); !errors.Is(err, errTruncated) {
+		t.Errorf("got error %v, want %v", err, errTruncated)
+	}
+}